@@ -1,6 +1,12 @@
 package cfgcore
 
 import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/namhoai1109/tabi/core/secret"
+
 	"github.com/caarlos0/env/v5"
 	"github.com/joho/godotenv"
 )
@@ -51,3 +57,35 @@ func PreloadLocalENV(stage string) error {
 func PreloadENV(stage string) error {
 	return godotenv.Load(".env")
 }
+
+// LoadWithSecrets loads configuration from .env file and the JSON secrets of the provider,
+// e.g. cfgcore.LoadWithSecrets(cfg, stage, secret.Default(), "tabi/"+stage+"/db")
+func LoadWithSecrets(out interface{}, stage string, provider secret.Provider, secretIDs ...string) error {
+	if err := PreloadENV(stage); err != nil {
+		return err
+	}
+	if err := PreloadSecrets(context.Background(), provider, secretIDs...); err != nil {
+		return err
+	}
+	return env.Parse(out)
+}
+
+// PreloadSecrets reads the JSON secrets of the provider and sets their values to os ENV,
+// the keys of the secrets are the ENV names. ENV already set are not overridden.
+func PreloadSecrets(ctx context.Context, provider secret.Provider, secretIDs ...string) error {
+	for _, id := range secretIDs {
+		values := make(map[string]interface{})
+		if err := secret.GetJSON(ctx, provider, id, &values); err != nil {
+			return err
+		}
+		for key, val := range values {
+			if _, ok := os.LookupEnv(key); ok {
+				continue
+			}
+			if err := os.Setenv(key, fmt.Sprintf("%v", val)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -15,3 +15,13 @@ func New(dbPsn string, cfg *gorm.Config) (*gorm.DB, error) {
 	}
 	return db, nil
 }
+
+// Close closes the underlying connection pool, e.g. in a shutdown hook:
+// server.OnShutdown("db", func(ctx context.Context) error { return dbcore.Close(db) })
+func Close(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
@@ -58,6 +58,8 @@ type ListQueryCondition struct {
 	Sort    []string
 	Page    int
 	PerPage int
+	// After selects the records after the cursor of keyset pagination, it is not applied to the total count
+	After *gowhere.Plan
 }
 
 // Create creates a new record on database.
@@ -80,6 +82,17 @@ func (cdb *DB) List(db *gorm.DB, output interface{}, lq *ListQueryCondition, cou
 			db = db.Where(lq.Filter.SQL(), lq.Filter.Vars()...)
 		}
 
+		if lq.After != nil {
+			// the total count includes the records before the cursor
+			if count != nil {
+				if err := db.Session(&gorm.Session{}).Model(output).Count(count).Error; err != nil {
+					return err
+				}
+				count = nil
+			}
+			db = db.Where(lq.After.SQL(), lq.After.Vars()...)
+		}
+
 		if lq.PerPage > 0 {
 			db = db.Limit(lq.PerPage)
 			if lq.Page > 1 {
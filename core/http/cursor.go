@@ -0,0 +1,170 @@
+package httpcore
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+
+	dbcore "github.com/namhoai1109/tabi/core/db"
+	"github.com/namhoai1109/tabi/core/server"
+
+	"github.com/imdatngo/gowhere"
+	"gorm.io/gorm/schema"
+)
+
+// Cursor is the position of the last record of a page for keyset pagination, the next page lists the records after it
+type Cursor struct {
+	// Sort is the sort of the list, e.g. "created_at DESC", so the cursor cannot be used with another sort
+	Sort string `json:"s"`
+	// Value is the sort column value of the last record, empty when the list is sorted by ID
+	Value interface{} `json:"v,omitempty"`
+	// ID is the primary key of the last record, breaking the ties of the sort column
+	ID interface{} `json:"id"`
+}
+
+var errInvalidCursor = server.NewHTTPValidationError("Invalid cursor")
+
+// schemaCache caches the parsed schemas of the listed records
+var schemaCache = &sync.Map{}
+
+// EncodeCursor encodes the cursor into an opaque string
+func EncodeCursor(cur *Cursor) (string, error) {
+	b, err := json.Marshal(cur)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// DecodeCursor decodes the opaque cursor
+func DecodeCursor(cursor string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	cur := new(Cursor)
+	if err := dec.Decode(cur); err != nil || cur.Sort == "" || cur.ID == nil {
+		return nil, errInvalidCursor
+	}
+	cur.Value = numberValue(cur.Value)
+	cur.ID = numberValue(cur.ID)
+	return cur, nil
+}
+
+// numberValue converts the JSON number to int64 or float64, so it is sent to the database as a number
+func numberValue(v interface{}) interface{} {
+	n, ok := v.(json.Number)
+	if !ok {
+		return v
+	}
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+	if f, err := n.Float64(); err == nil {
+		return f
+	}
+	return n.String()
+}
+
+// sortKey returns the sort column and order of the list and the ID column breaking the ties, e.g.
+// "created_at", "DESC", "id". The ID column has the table of the sort column if any.
+func sortKey(sort []string) (string, string, string) {
+	if len(sort) == 0 {
+		return "id", "ASC", "id"
+	}
+	column, order, _ := strings.Cut(sort[0], " ")
+	if order == "" {
+		order = "ASC"
+	}
+	idColumn := "id"
+	if i := strings.LastIndex(column, "."); i >= 0 {
+		idColumn = column[:i+1] + idColumn
+	}
+	return column, order, idColumn
+}
+
+// applyCursor sorts the list by ID after the sort column, so the pages are stable,
+// and selects the records after the cursor instead of the page number
+func applyCursor(lq *dbcore.ListQueryCondition, cursor string) error {
+	column, order, idColumn := sortKey(lq.Sort)
+	if column != idColumn {
+		lq.Sort = append(lq.Sort, idColumn+" "+order)
+	} else if len(lq.Sort) == 0 {
+		lq.Sort = []string{idColumn + " " + order}
+	}
+	if cursor == "" {
+		return nil
+	}
+
+	cur, err := DecodeCursor(cursor)
+	if err != nil {
+		return err
+	}
+	if cur.Sort != lq.Sort[0] {
+		return errInvalidCursor
+	}
+	op := ">"
+	if order == "DESC" {
+		op = "<"
+	}
+	if column == idColumn {
+		lq.After = gowhere.Where(idColumn+" "+op+" ?", cur.ID)
+	} else {
+		lq.After = gowhere.Where("("+column+", "+idColumn+") "+op+" (?, ?)", cur.Value, cur.ID)
+	}
+	lq.Page = 0
+	return nil
+}
+
+// nextCursor returns the cursor of the last record of the data, empty when the sort column or the primary key
+// are not fields of the records
+func nextCursor(lq *dbcore.ListQueryCondition, data interface{}) string {
+	rv := reflect.Indirect(reflect.ValueOf(data))
+	if dataLen(data) == 0 {
+		return ""
+	}
+	last := rv.Index(rv.Len() - 1)
+	for last.Kind() == reflect.Interface || last.Kind() == reflect.Ptr {
+		last = last.Elem()
+	}
+	s, err := schema.Parse(last.Interface(), schemaCache, schema.NamingStrategy{})
+	if err != nil || s.PrioritizedPrimaryField == nil {
+		return ""
+	}
+
+	var sort []string
+	if lq != nil {
+		sort = lq.Sort
+	}
+	column, order, idColumn := sortKey(sort)
+	ctx := context.Background()
+	cur := &Cursor{Sort: column + " " + order}
+	cur.ID, _ = s.PrioritizedPrimaryField.ValueOf(ctx, last)
+	if column != idColumn {
+		field := s.LookUpField(strings.Trim(column[strings.LastIndex(column, ".")+1:], `"`))
+		if field == nil {
+			return ""
+		}
+		cur.Value, _ = field.ValueOf(ctx, last)
+	}
+	cursor, err := EncodeCursor(cur)
+	if err != nil {
+		return ""
+	}
+	return cursor
+}
+
+// dataLen returns the number of the listed records, 0 when the data is not a slice
+func dataLen(data interface{}) int {
+	rv := reflect.Indirect(reflect.ValueOf(data))
+	if rv.Kind() != reflect.Slice {
+		return 0
+	}
+	return rv.Len()
+}
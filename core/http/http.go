@@ -59,6 +59,9 @@ type ListRequest struct {
 	// JSON string of filter. E.g: {"field_name":"value"}
 	// default:
 	Filter string `json:"f,omitempty" query:"f"`
+	// Cursor of the page, returned as next_cursor of the previous page. It takes precedence over the page number
+	// default:
+	Cursor string `json:"cursor,omitempty" query:"cursor"`
 }
 
 // ReqListQuery parses url query string for listing request
@@ -75,7 +78,6 @@ func ReqListQuery(c echo.Context) (*dbcore.ListQueryCondition, error) {
 		PerPage: lr.Limit,
 		Filter:  gowhere.WithConfig(gowhere.Config{Strict: true}),
 	}
-
 	if lr.Filter != "" {
 		var filter interface{}
 		err := json.Unmarshal([]byte(lr.Filter), &filter)
@@ -100,6 +102,9 @@ func ReqListQuery(c echo.Context) (*dbcore.ListQueryCondition, error) {
 		lq.Sort = []string{sortField + " " + sortOrder}
 	}
 
+	if err := applyCursor(lq, lr.Cursor); err != nil {
+		return nil, err
+	}
 	return lq, nil
 }
 
@@ -122,7 +127,6 @@ func ReqListQueryWithDefault(c echo.Context, defaultValues map[string]interface{
 		PerPage: lr.Limit,
 		Filter:  gowhere.WithConfig(gowhere.Config{Strict: true}),
 	}
-
 	if lr.Filter != "" {
 		var filter interface{}
 		err := json.Unmarshal([]byte(lr.Filter), &filter)
@@ -162,5 +166,8 @@ func ReqListQueryWithDefault(c echo.Context, defaultValues map[string]interface{
 		lq.Sort = []string{sortField + " " + sortOrder}
 	}
 
+	if err := applyCursor(lq, lr.Cursor); err != nil {
+		return nil, err
+	}
 	return lq, nil
 }
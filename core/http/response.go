@@ -0,0 +1,128 @@
+package httpcore
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	dbcore "github.com/namhoai1109/tabi/core/db"
+	"github.com/namhoai1109/tabi/core/server"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HeaderTotalCount holds the total count of records of CSV list responses
+const HeaderTotalCount = "X-Total-Count"
+
+// Envelope is the common shape of response bodies
+type Envelope struct {
+	Data interface{} `json:"data"`
+	Meta interface{} `json:"meta,omitempty"`
+}
+
+// ListMeta holds the pagination metadata of list responses
+type ListMeta struct {
+	// Page is the page number, empty when the page is listed by cursor
+	Page       int   `json:"page,omitempty"`
+	PerPage    int   `json:"per_page"`
+	Total      int64 `json:"total"`
+	TotalPages int   `json:"total_pages"`
+	// NextCursor can be sent as the cursor query param to get the next page, empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// NewListMeta creates the pagination metadata from the list query condition, the listed records and the total count.
+// The next cursor is the position of the last record, see Cursor.
+func NewListMeta(lq *dbcore.ListQueryCondition, data interface{}, total int64) *ListMeta {
+	meta := &ListMeta{Page: 1, Total: total}
+	if lq != nil {
+		if lq.Page > 1 {
+			meta.Page = lq.Page
+		}
+		if lq.After != nil {
+			meta.Page = 0
+		}
+		meta.PerPage = lq.PerPage
+	}
+
+	switch {
+	case total == 0:
+		meta.TotalPages = 0
+	case meta.PerPage <= 0:
+		meta.TotalPages = 1
+	default:
+		meta.TotalPages = int((total + int64(meta.PerPage) - 1) / int64(meta.PerPage))
+	}
+
+	hasNext := meta.Page < meta.TotalPages
+	if meta.Page == 0 {
+		// the position of the cursor page is unknown, so a full page may be followed by more records
+		hasNext = meta.PerPage > 0 && dataLen(data) == meta.PerPage
+	}
+	if hasNext {
+		meta.NextCursor = nextCursor(lq, data)
+	}
+	return meta
+}
+
+// Render renders the data in the response envelope
+func Render(c echo.Context, code int, data interface{}) error {
+	return c.JSON(code, Envelope{Data: data})
+}
+
+// RenderList renders the page of records in the response envelope with the pagination metadata
+// and RFC 8288 Link headers of the first and next pages. E.g:
+//
+//	data := []*model.User{}
+//	var count int64
+//	if err := s.udb.List(s.db, &data, lq, &count); err != nil {
+//		return err
+//	}
+//	return httpcore.RenderList(c, data, lq, count)
+func RenderList(c echo.Context, data interface{}, lq *dbcore.ListQueryCondition, total int64) error {
+	return RenderListWithMeta(c, data, NewListMeta(lq, data, total))
+}
+
+// RenderListWithMeta renders the page of records with the given pagination metadata,
+// e.g. when the next cursor is built by the service.
+// The records are rendered as CSV when the request prefers text/csv, the total count is sent in X-Total-Count header then.
+func RenderListWithMeta(c echo.Context, data interface{}, meta *ListMeta) error {
+	if links := PaginationLinks(c, meta); len(links) > 0 {
+		c.Response().Header().Set("Link", strings.Join(links, ", "))
+	}
+	if server.WantsCSV(c) {
+		if meta != nil {
+			c.Response().Header().Set(HeaderTotalCount, strconv.FormatInt(meta.Total, 10))
+		}
+		return server.RenderCSV(c, http.StatusOK, data)
+	}
+	return c.JSON(http.StatusOK, Envelope{Data: data, Meta: meta})
+}
+
+// PaginationLinks returns the RFC 8288 links of the first and next pages of the request,
+// the next page is linked by the cursor of the metadata
+func PaginationLinks(c echo.Context, meta *ListMeta) []string {
+	if meta == nil || meta.TotalPages == 0 {
+		return nil
+	}
+
+	req := c.Request()
+	link := func(cursor, rel string) string {
+		u := *req.URL
+		q := u.Query()
+		q.Del("p")
+		q.Del("cursor")
+		if cursor != "" {
+			q.Set("cursor", cursor)
+		}
+		u.RawQuery = q.Encode()
+		return fmt.Sprintf(`<%s://%s%s>; rel="%s"`, c.Scheme(), req.Host, u.RequestURI(), rel)
+	}
+
+	links := []string{link("", "first")}
+	if meta.NextCursor != "" {
+		links = append(links, link(meta.NextCursor, "next"))
+	}
+	return links
+}
@@ -0,0 +1,29 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// unmatchedRoute is the route label of requests not matching any route, so unknown paths cannot explode the cardinality
+const unmatchedRoute = "unmatched"
+
+// Middleware returns a middleware which records the rate, errors and duration of the requests by route template.
+// Note: it must be registered before the middleware rendering the errors, so the response status is final.
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+
+			route := c.Path()
+			if route == "" || route == "/*" {
+				route = unmatchedRoute
+			}
+			res := c.Response()
+			observeHTTP(c.Request().Method, route, res.Status, res.Size, time.Since(start))
+			return err
+		}
+	}
+}
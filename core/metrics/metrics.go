@@ -0,0 +1,143 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Namespace is the prefix of all metrics of the core packages
+const Namespace = "tabi"
+
+// Label values of the query and message results
+const (
+	StatusOK    = "ok"
+	StatusError = "error"
+)
+
+var registry = newRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Number of HTTP requests by route template and status.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of HTTP requests by route template and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	httpResponseSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Subsystem: "http",
+		Name:      "response_size_bytes",
+		Help:      "Size of HTTP responses by route template.",
+		Buckets:   prometheus.ExponentialBuckets(100, 10, 6),
+	}, []string{"method", "route"})
+
+	dbDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Subsystem: "db",
+		Name:      "query_duration_seconds",
+		Help:      "Latency of database queries by operation and status.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"operation", "status"})
+
+	outboundRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "outbound",
+		Name:      "requests_total",
+		Help:      "Number of outbound HTTP requests by client, host and status.",
+	}, []string{"client", "host", "method", "status"})
+
+	outboundDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Subsystem: "outbound",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of outbound HTTP requests by client, host and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"client", "host", "method", "status"})
+
+	sqsMessagesSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "sqs",
+		Name:      "messages_sent_total",
+		Help:      "Number of messages sent to SQS by queue and status.",
+	}, []string{"queue", "status"})
+)
+
+// newRegistry creates the registry of the core metrics, including the Go runtime and process metrics
+func newRegistry() *prometheus.Registry {
+	r := prometheus.NewRegistry()
+	r.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration, httpResponseSize,
+		dbDuration,
+		outboundRequests, outboundDuration,
+		sqsMessagesSent,
+	)
+	return r
+}
+
+// Registry returns the registry exposed by Handler
+func Registry() *prometheus.Registry {
+	return registry
+}
+
+// Register registers the metrics of the service, so they are exposed by Handler
+func Register(cs ...prometheus.Collector) error {
+	for _, c := range cs {
+		if err := registry.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler returns the handler exposing the metrics in the Prometheus text format, e.g:
+// e.GET("/metrics", metrics.Handler())
+func Handler() echo.HandlerFunc {
+	return echo.WrapHandler(promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry}))
+}
+
+// ObserveDBQuery records the latency of the database query
+func ObserveDBQuery(operation string, duration time.Duration, err error) {
+	dbDuration.WithLabelValues(operation, status(err)).Observe(duration.Seconds())
+}
+
+// ObserveOutbound records the outbound HTTP request, status is the HTTP status code or StatusError
+func ObserveOutbound(client, host, method, status string, duration time.Duration) {
+	outboundRequests.WithLabelValues(client, host, method, status).Inc()
+	outboundDuration.WithLabelValues(client, host, method, status).Observe(duration.Seconds())
+}
+
+// IncSQSSent counts the message sent to the queue
+func IncSQSSent(queue string, err error) {
+	sqsMessagesSent.WithLabelValues(queue, status(err)).Inc()
+}
+
+// observeHTTP records the HTTP request handled by the server
+func observeHTTP(method, route string, code int, size int64, duration time.Duration) {
+	statusCode := strconv.Itoa(code)
+	httpRequests.WithLabelValues(method, route, statusCode).Inc()
+	httpDuration.WithLabelValues(method, route, statusCode).Observe(duration.Seconds())
+	httpResponseSize.WithLabelValues(method, route).Observe(float64(size))
+}
+
+func status(err error) string {
+	if err != nil {
+		return StatusError
+	}
+	return StatusOK
+}
@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// InstrumentClient records the outbound requests of the resty client under the client name, e.g. "s2s", "paypal"
+func InstrumentClient(client *resty.Client, name string) *resty.Client {
+	client.OnAfterResponse(func(c *resty.Client, resp *resty.Response) error {
+		ObserveOutbound(name, requestHost(c, resp.Request), resp.Request.Method, strconv.Itoa(resp.StatusCode()), resp.Time())
+		return nil
+	})
+	client.OnError(func(req *resty.Request, err error) {
+		var duration time.Duration
+		if !req.Time.IsZero() {
+			duration = time.Since(req.Time)
+		}
+		ObserveOutbound(name, requestHost(client, req), req.Method, StatusError, duration)
+	})
+	return client
+}
+
+// requestHost returns the host of the request, falling back to the base URL of the client
+func requestHost(c *resty.Client, req *resty.Request) string {
+	if req.RawRequest != nil && req.RawRequest.URL != nil {
+		return req.RawRequest.URL.Host
+	}
+	if u, err := url.Parse(c.BaseURL); err == nil {
+		return u.Host
+	}
+	return ""
+}
@@ -0,0 +1,116 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/namhoai1109/tabi/core/logger"
+)
+
+// HeaderAPIKey is the header of the API key
+const HeaderAPIKey = "X-API-Key"
+
+// keyPrefix starts the API keys, so leaked keys can be detected by secret scanners
+const keyPrefix = "tabi_"
+
+// Errors of the key verification
+var (
+	ErrInvalidKey = errors.New("api key invalid")
+	ErrExpiredKey = errors.New("api key expired")
+	ErrRevokedKey = errors.New("api key revoked")
+)
+
+// Store finds the keys by prefix
+type Store interface {
+	// FindByPrefix returns the key of the prefix, ErrInvalidKey when not found
+	FindByPrefix(ctx context.Context, prefix string) (*Key, error)
+	// TouchLastUsed updates the last used time of the key
+	TouchLastUsed(ctx context.Context, id int, at time.Time) error
+}
+
+// Generate generates new API key of the client, returning the key to be given to the client once
+// and the record to be saved in the store
+func Generate(name, role string, scopes []string, expiresAt *time.Time) (string, *Key, error) {
+	b := make([]byte, 38)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	prefix := hex.EncodeToString(b[:6])
+	secret := base64.RawURLEncoding.EncodeToString(b[6:])
+	return keyPrefix + prefix + "_" + secret, &Key{
+		Name:      name,
+		Prefix:    prefix,
+		Hash:      hashSecret(secret),
+		Role:      role,
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// Config represents the config of the API key service
+type Config struct {
+	Store Store
+	// TouchInterval is the min interval of updating the last used time of a key, default is 1 minute
+	TouchInterval time.Duration
+}
+
+// Service verifies the API keys of the clients
+type Service struct {
+	cfg Config
+}
+
+// New creates new API key service
+func New(store Store) *Service {
+	return NewWithConfig(Config{Store: store})
+}
+
+// NewWithConfig creates new API key service with config
+func NewWithConfig(cfg Config) *Service {
+	if cfg.TouchInterval <= 0 {
+		cfg.TouchInterval = time.Minute
+	}
+	return &Service{cfg: cfg}
+}
+
+// Verify returns the key of the API key when it is valid, not expired nor revoked
+func (s *Service) Verify(ctx context.Context, apiKey string) (*Key, error) {
+	prefix, secret, ok := strings.Cut(strings.TrimPrefix(apiKey, keyPrefix), "_")
+	if !ok || !strings.HasPrefix(apiKey, keyPrefix) {
+		return nil, ErrInvalidKey
+	}
+	key, err := s.cfg.Store.FindByPrefix(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(key.Hash)) != 1 {
+		return nil, ErrInvalidKey
+	}
+
+	now := time.Now()
+	if key.RevokedAt != nil {
+		return nil, ErrRevokedKey
+	}
+	if key.ExpiresAt != nil && now.After(*key.ExpiresAt) {
+		return nil, ErrExpiredKey
+	}
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= s.cfg.TouchInterval {
+		if err := s.cfg.Store.TouchLastUsed(ctx, key.ID, now); err != nil {
+			logger.LogError(ctx, fmt.Sprintf("failed to update last used of api key %s with err: %v", key.Prefix, err))
+		}
+	}
+	return key, nil
+}
+
+// hashSecret hashes the secret of the key, the secrets are random so a fast hash is enough
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,27 @@
+package apikey
+
+import "time"
+
+// Key represents an API key of a client, only the hash of the secret is stored.
+// It can be used to migrate the table, e.g. db.AutoMigrate(&apikey.Key{})
+type Key struct {
+	ID int `json:"id" gorm:"primaryKey"`
+	// Name is the client of the key, e.g. "booking-service"
+	Name string `json:"name" gorm:"type:varchar(255);not null;index"`
+	// Prefix identifies the key publicly, e.g. in logs, it is the part of the key before the secret
+	Prefix string   `json:"prefix" gorm:"type:varchar(32);not null;uniqueIndex"`
+	Hash   string   `json:"-" gorm:"type:varchar(64);not null"`
+	Role   string   `json:"role" gorm:"type:varchar(50)"`
+	Scopes []string `json:"scopes" gorm:"type:text;serializer:json"`
+
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// TableName returns the table of the keys
+func (Key) TableName() string {
+	return "api_keys"
+}
@@ -0,0 +1,153 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	dbcore "github.com/namhoai1109/tabi/core/db"
+	"github.com/namhoai1109/tabi/core/secret"
+
+	"gorm.io/gorm"
+)
+
+// PostgresStore keeps the keys in the api_keys table
+type PostgresStore struct {
+	db *gorm.DB
+}
+
+// NewPostgresStore creates new Postgres key store
+func NewPostgresStore(db *gorm.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// FindByPrefix implements Store
+func (s *PostgresStore) FindByPrefix(ctx context.Context, prefix string) (*Key, error) {
+	key := new(Key)
+	if err := dbcore.NewDB(&Key{}).View(s.db.WithContext(ctx), key, "prefix = ?", prefix); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidKey
+		}
+		return nil, err
+	}
+	return key, nil
+}
+
+// TouchLastUsed implements Store
+func (s *PostgresStore) TouchLastUsed(ctx context.Context, id int, at time.Time) error {
+	return dbcore.NewDB(&Key{}).Update(s.db.WithContext(ctx), map[string]interface{}{"last_used_at": at}, "id = ?", id)
+}
+
+// Create saves the generated key
+func (s *PostgresStore) Create(ctx context.Context, key *Key) error {
+	return dbcore.NewDB(&Key{}).Create(s.db.WithContext(ctx), key)
+}
+
+// List lists the keys of the client, or all keys when name is empty
+func (s *PostgresStore) List(ctx context.Context, name string) ([]*Key, error) {
+	keys := []*Key{}
+	db := s.db.WithContext(ctx)
+	if name != "" {
+		db = db.Where("name = ?", name)
+	}
+	if err := dbcore.NewDB(&Key{}).List(db, &keys, &dbcore.ListQueryCondition{Sort: []string{"id"}}, nil); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Revoke revokes the key, e.g. when it is leaked or the client is rotating keys
+func (s *PostgresStore) Revoke(ctx context.Context, id int) error {
+	return dbcore.NewDB(&Key{}).Update(s.db.WithContext(ctx), map[string]interface{}{"revoked_at": time.Now()}, "id = ?", id)
+}
+
+// SecretStore reads the keys from a secret, e.g. in Secrets Manager, holding the JSON array of the keys:
+//
+//	[{"name": "booking-service", "prefix": "...", "hash": "...", "role": "REP", "scopes": ["booking:write"]}]
+//
+// The secret is read-only, so the last used time is not tracked.
+type SecretStore struct {
+	provider secret.Provider
+	secretID string
+
+	mu          sync.Mutex
+	refreshedAt time.Time
+}
+
+// minRefreshInterval is the min interval of refreshing the secret, so unknown prefixes cannot flood the provider
+const minRefreshInterval = 30 * time.Second
+
+// secretKey is a key of the secret, Key does not decode the hash from JSON so it is never exposed
+type secretKey struct {
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	Hash      string     `json:"hash"`
+	Role      string     `json:"role"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+// NewSecretStore creates new key store reading the secret of the provider, nil provider uses secret.Default()
+func NewSecretStore(provider secret.Provider, secretID string) *SecretStore {
+	if provider == nil {
+		provider = secret.Default()
+	}
+	return &SecretStore{provider: provider, secretID: secretID}
+}
+
+// FindByPrefix implements Store, the secret is refreshed when the key is not found as it may have just been added.
+// The secret is refreshed at most once per 30 seconds.
+func (s *SecretStore) FindByPrefix(ctx context.Context, prefix string) (*Key, error) {
+	keys := []*secretKey{}
+	if err := secret.GetJSON(ctx, s.provider, s.secretID, &keys); err != nil {
+		return nil, err
+	}
+	if key := findByPrefix(keys, prefix); key != nil {
+		return key, nil
+	}
+	if !s.allowRefresh() {
+		return nil, ErrInvalidKey
+	}
+	if err := secret.RefreshJSON(ctx, s.provider, s.secretID, &keys); err != nil {
+		return nil, err
+	}
+	if key := findByPrefix(keys, prefix); key != nil {
+		return key, nil
+	}
+	return nil, ErrInvalidKey
+}
+
+// allowRefresh checks whether the secret was not refreshed within the min interval, marking it refreshed
+func (s *SecretStore) allowRefresh() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Since(s.refreshedAt) < minRefreshInterval {
+		return false
+	}
+	s.refreshedAt = time.Now()
+	return true
+}
+
+// TouchLastUsed implements Store, it is a no-op
+func (s *SecretStore) TouchLastUsed(ctx context.Context, id int, at time.Time) error {
+	return nil
+}
+
+func findByPrefix(keys []*secretKey, prefix string) *Key {
+	for _, key := range keys {
+		if key.Prefix == prefix {
+			return &Key{
+				Name:      key.Name,
+				Prefix:    key.Prefix,
+				Hash:      key.Hash,
+				Role:      key.Role,
+				Scopes:    key.Scopes,
+				ExpiresAt: key.ExpiresAt,
+				RevokedAt: key.RevokedAt,
+			}
+		}
+	}
+	return nil
+}
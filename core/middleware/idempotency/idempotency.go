@@ -0,0 +1,338 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	dbcore "github.com/namhoai1109/tabi/core/db"
+	"github.com/namhoai1109/tabi/core/logger"
+	"github.com/namhoai1109/tabi/core/middleware/logadapter"
+	"github.com/namhoai1109/tabi/core/server"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Idempotency headers
+const (
+	HeaderIdempotencyKey = "Idempotency-Key"
+	// HeaderIdempotentReplayed is set to "true" on replayed responses
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+)
+
+// maxKeyLength is the max length of idempotency keys
+const maxKeyLength = 255
+
+// skippedHeaders are the response headers of the first request which are not replayed.
+// The encoding headers are set by the compress middleware for the compressed body, while the stored body
+// is uncompressed, so they are skipped and the replayed body is compressed again.
+var skippedHeaders = []string{
+	string(logadapter.RequestIDKey),
+	string(logadapter.CorrelationIDKey),
+	echo.HeaderSetCookie,
+	echo.HeaderContentLength,
+	echo.HeaderContentEncoding,
+	echo.HeaderVary,
+}
+
+// Config represents idempotency middleware specific config
+type Config struct {
+	Skipper middleware.Skipper
+	// DB stores the records in the idempotency_keys table
+	DB *gorm.DB
+	// TTL is the duration the responses are replayed, default is 24 hours
+	TTL time.Duration
+	// LockTimeout is the duration after which a request still in flight is considered failed,
+	// e.g. the Lambda timed out, so the key can be retried. Default is 1 minute
+	LockTimeout time.Duration
+	// Methods are the methods honoring the Idempotency-Key header, default are POST, PUT, PATCH and DELETE
+	Methods []string
+	// ScopeFunc returns the owner of the key, default is the "id" claim of the JWT.
+	// The client IP is used when it returns empty scope.
+	ScopeFunc func(c echo.Context) string
+}
+
+// DefaultConfig is the default idempotency middleware config
+var DefaultConfig = Config{
+	Skipper:     middleware.DefaultSkipper,
+	TTL:         24 * time.Hour,
+	LockTimeout: time.Minute,
+	Methods:     []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete},
+	ScopeFunc:   ScopeByClaim("id"),
+}
+
+// ScopeByClaim scopes the keys by the JWT claim, e.g. the user ID. The JWT middleware must be executed before.
+func ScopeByClaim(claim string) func(c echo.Context) string {
+	return func(c echo.Context) string {
+		if val := c.Get(claim); val != nil {
+			return fmt.Sprintf("%v", val)
+		}
+		return ""
+	}
+}
+
+// New creates new idempotency middleware storing the responses in the database
+func New(db *gorm.DB) echo.MiddlewareFunc {
+	c := DefaultConfig
+	c.DB = db
+	return NewWithConfig(c)
+}
+
+// NewWithConfig creates new idempotency middleware with config.
+// The first response of a key is stored and replayed for retries of the same request,
+// 409 is returned while the first request is still in flight and 422 when the key is reused for another request.
+// Server errors (5xx) are not stored, so the request can be retried.
+func NewWithConfig(config Config) echo.MiddlewareFunc {
+	if config.DB == nil {
+		panic("idempotency middleware requires db")
+	}
+	if config.Skipper == nil {
+		config.Skipper = DefaultConfig.Skipper
+	}
+	if config.TTL == 0 {
+		config.TTL = DefaultConfig.TTL
+	}
+	if config.LockTimeout == 0 {
+		config.LockTimeout = DefaultConfig.LockTimeout
+	}
+	if config.Methods == nil {
+		config.Methods = DefaultConfig.Methods
+	}
+	if config.ScopeFunc == nil {
+		config.ScopeFunc = DefaultConfig.ScopeFunc
+	}
+	methods := make(map[string]bool, len(config.Methods))
+	for _, m := range config.Methods {
+		methods[m] = true
+	}
+	s := &store{db: config.DB, ttl: config.TTL, lockTimeout: config.LockTimeout}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			key := req.Header.Get(HeaderIdempotencyKey)
+			if config.Skipper(c) || key == "" || !methods[req.Method] {
+				return next(c)
+			}
+			if len(key) > maxKeyLength {
+				return server.NewHTTPValidationError(fmt.Sprintf("%s must not exceed %d characters", HeaderIdempotencyKey, maxKeyLength))
+			}
+
+			fingerprint, err := requestFingerprint(req)
+			if err != nil {
+				return err
+			}
+
+			// the anonymous callers are scoped by IP, so they cannot replay the responses of each other
+			scope := config.ScopeFunc(c)
+			if scope == "" {
+				scope = "ip:" + c.RealIP()
+			}
+
+			ctx := req.Context()
+			rec, acquired, err := s.acquire(ctx, scope, key, fingerprint)
+			if err != nil {
+				return server.NewHTTPInternalError("Failed to process idempotency key").SetInternal(err)
+			}
+			if !acquired {
+				return replay(c, rec, fingerprint)
+			}
+
+			resBody := new(bytes.Buffer)
+			writer := &bodyWriter{Writer: io.MultiWriter(c.Response().Writer, resBody), ResponseWriter: c.Response().Writer}
+			c.Response().Writer = writer
+			if err := next(c); err != nil {
+				// render the error, so the error response is stored as well
+				c.Error(err)
+			}
+
+			res := c.Response()
+			if res.Status >= http.StatusInternalServerError {
+				if err := s.release(ctx, rec); err != nil {
+					logger.LogError(ctx, fmt.Sprintf("failed to release idempotency key %s with err: %v", key, err))
+				}
+				return nil
+			}
+			if err := s.complete(ctx, rec, res.Status, res.Header(), resBody.Bytes()); err != nil {
+				logger.LogError(ctx, fmt.Sprintf("failed to store response of idempotency key %s with err: %v", key, err))
+			}
+			return nil
+		}
+	}
+}
+
+// replay writes the stored response of the record
+func replay(c echo.Context, rec *Record, fingerprint string) error {
+	if rec.Fingerprint != fingerprint {
+		return server.NewHTTPError(http.StatusUnprocessableEntity, server.GenericErrorType,
+			fmt.Sprintf("%s has been used for another request", HeaderIdempotencyKey))
+	}
+	if rec.Status != StatusCompleted {
+		return server.NewHTTPError(http.StatusConflict, server.GenericErrorType,
+			"The request with the same idempotency key is still in progress")
+	}
+
+	headers := http.Header{}
+	if rec.ResponseHeaders != "" {
+		if err := json.Unmarshal([]byte(rec.ResponseHeaders), &headers); err != nil {
+			return server.NewHTTPInternalError("Failed to replay response").SetInternal(err)
+		}
+	}
+	for name, values := range headers {
+		for _, v := range values {
+			c.Response().Header().Add(name, v)
+		}
+	}
+	c.Response().Header().Set(HeaderIdempotentReplayed, "true")
+	c.Response().WriteHeader(rec.ResponseCode)
+	_, err := c.Response().Write(rec.ResponseBody)
+	return err
+}
+
+// requestFingerprint hashes the method, path and body of the request, restoring the body for the handler
+func requestFingerprint(req *http.Request) (string, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return "", err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	h := sha256.New()
+	h.Write([]byte(req.Method + " " + req.URL.Path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// bodyWriter copies the response body of the handler
+type bodyWriter struct {
+	io.Writer
+	http.ResponseWriter
+}
+
+func (w *bodyWriter) WriteHeader(code int) {
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *bodyWriter) Write(b []byte) (int, error) {
+	return w.Writer.Write(b)
+}
+
+func (w *bodyWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// store manages the records in the database
+type store struct {
+	db          *gorm.DB
+	ttl         time.Duration
+	lockTimeout time.Duration
+}
+
+// acquire locks the key for the request, or returns the existing record when it is locked or completed
+func (s *store) acquire(ctx context.Context, scope, key, fingerprint string) (*Record, bool, error) {
+	db := s.db.WithContext(ctx)
+	repo := dbcore.NewDB(&Record{})
+	now := time.Now()
+	rec := &Record{
+		Scope:       scope,
+		Key:         key,
+		Fingerprint: fingerprint,
+		Status:      StatusProcessing,
+		LockedAt:    now,
+		ExpiresAt:   now.Add(s.ttl),
+	}
+	onConflict := clause.OnConflict{Columns: []clause.Column{{Name: "scope"}, {Name: "key"}}, DoNothing: true}
+	if err := repo.Create(db.Clauses(onConflict), rec); err != nil {
+		return nil, false, err
+	}
+	if repo.GDB.RowsAffected == 1 {
+		return rec, true, nil
+	}
+
+	existing := new(Record)
+	if err := repo.View(db, existing, "scope = ? AND key = ?", scope, key); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// released meanwhile, the client should retry
+			existing.Status, existing.Fingerprint = StatusProcessing, fingerprint
+			return existing, false, nil
+		}
+		return nil, false, err
+	}
+
+	// take over the expired key, or the key of the failed request
+	expired := now.After(existing.ExpiresAt)
+	stale := existing.Status == StatusProcessing && now.Sub(existing.LockedAt) > s.lockTimeout
+	if !expired && !stale {
+		return existing, false, nil
+	}
+	if err := repo.Update(db, map[string]interface{}{
+		"fingerprint":      fingerprint,
+		"status":           StatusProcessing,
+		"response_code":    0,
+		"response_headers": "",
+		"response_body":    nil,
+		"locked_at":        now,
+		"expires_at":       now.Add(s.ttl),
+	}, "id = ? AND locked_at = ?", existing.ID, existing.LockedAt); err != nil {
+		return nil, false, err
+	}
+	if repo.GDB.RowsAffected != 1 {
+		// taken over by another request
+		existing.Status, existing.Fingerprint = StatusProcessing, fingerprint
+		return existing, false, nil
+	}
+	rec.ID = existing.ID
+	return rec, true, nil
+}
+
+// complete stores the response of the record
+func (s *store) complete(ctx context.Context, rec *Record, code int, header http.Header, body []byte) error {
+	headers, err := storedHeaders(header)
+	if err != nil {
+		return err
+	}
+	return dbcore.NewDB(&Record{}).Update(s.db.WithContext(ctx), map[string]interface{}{
+		"status":           StatusCompleted,
+		"response_code":    code,
+		"response_headers": headers,
+		"response_body":    body,
+	}, "id = ?", rec.ID)
+}
+
+// storedHeaders returns the JSON of the response headers to be replayed
+func storedHeaders(header http.Header) (string, error) {
+	headers := header.Clone()
+	for _, name := range skippedHeaders {
+		headers.Del(name)
+	}
+	b, err := json.Marshal(headers)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// release deletes the record, so the key can be retried
+func (s *store) release(ctx context.Context, rec *Record) error {
+	return dbcore.NewDB(&Record{}).Delete(s.db.WithContext(ctx), "id = ?", rec.ID)
+}
+
+// DeleteExpired deletes the expired records, e.g. in a scheduled job
+func DeleteExpired(ctx context.Context, db *gorm.DB) error {
+	return db.WithContext(ctx).Where("expires_at < ?", time.Now()).Delete(&Record{}).Error
+}
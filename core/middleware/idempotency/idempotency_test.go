@@ -0,0 +1,77 @@
+package idempotency
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/namhoai1109/tabi/core/server"
+)
+
+// TestReplayCompressed stores the response of the first request behind the compress middleware
+// as the middleware does, then replays it through the compress middleware again
+func TestReplayCompressed(t *testing.T) {
+	body := `{"data":"` + strings.Repeat("tabi", server.DefaultCompressMinLength) + `"}`
+	rec := &Record{Fingerprint: "fp", Status: StatusCompleted}
+
+	e := echo.New()
+	e.Use(server.CompressWithConfig(server.CompressConfig{Encodings: []string{server.EncodingGzip}}))
+	e.POST("/first", func(c echo.Context) error {
+		return c.JSONBlob(http.StatusCreated, []byte(body))
+	}, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			resBody := new(bytes.Buffer)
+			c.Response().Writer = &bodyWriter{Writer: io.MultiWriter(c.Response().Writer, resBody), ResponseWriter: c.Response().Writer}
+			if err := next(c); err != nil {
+				return err
+			}
+			headers, err := storedHeaders(c.Response().Header())
+			if err != nil {
+				return err
+			}
+			rec.ResponseCode = c.Response().Status
+			rec.ResponseHeaders = headers
+			rec.ResponseBody = resBody.Bytes()
+			return nil
+		}
+	})
+	e.POST("/replay", func(c echo.Context) error {
+		return replay(c, rec, "fp")
+	})
+
+	for _, path := range []string{"/first", "/replay"} {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.Header.Set(echo.HeaderAcceptEncoding, "gzip")
+		res := httptest.NewRecorder()
+		e.ServeHTTP(res, req)
+
+		if res.Code != http.StatusCreated {
+			t.Fatalf("%s: status = %d", path, res.Code)
+		}
+		if got := res.Header().Get(echo.HeaderContentEncoding); got != server.EncodingGzip {
+			t.Fatalf("%s: Content-Encoding = %q", path, got)
+		}
+		if got := res.Header().Values(echo.HeaderVary); len(got) != 1 {
+			t.Errorf("%s: Vary = %v", path, got)
+		}
+		r, err := gzip.NewReader(res.Body)
+		if err != nil {
+			t.Fatalf("%s: invalid gzip body: %v", path, err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%s: invalid gzip body: %v", path, err)
+		}
+		if string(got) != body {
+			t.Errorf("%s: body = %.50s..., want %.50s...", path, got, body)
+		}
+	}
+	if string(rec.ResponseBody) != body {
+		t.Errorf("stored body = %.50s..., want the uncompressed body", rec.ResponseBody)
+	}
+}
@@ -0,0 +1,35 @@
+package idempotency
+
+import "time"
+
+// Record statuses
+const (
+	StatusProcessing = "processing"
+	StatusCompleted  = "completed"
+)
+
+// Record represents the stored response of an idempotency key,
+// it can be used to migrate the table, e.g. db.AutoMigrate(&idempotency.Record{})
+type Record struct {
+	ID int `json:"id" gorm:"primaryKey"`
+	// Scope is the owner of the key, e.g. the user ID
+	Scope string `json:"scope" gorm:"type:varchar(255);not null;uniqueIndex:idx_idempotency_keys_scope_key"`
+	Key   string `json:"key" gorm:"type:varchar(255);not null;uniqueIndex:idx_idempotency_keys_scope_key"`
+	// Fingerprint is the hash of the method, path and body of the first request
+	Fingerprint string `json:"fingerprint" gorm:"type:varchar(64);not null"`
+	Status      string `json:"status" gorm:"type:varchar(20);not null"`
+
+	ResponseCode    int    `json:"response_code"`
+	ResponseHeaders string `json:"response_headers" gorm:"type:text"`
+	ResponseBody    []byte `json:"response_body" gorm:"type:bytea"`
+
+	LockedAt  time.Time `json:"locked_at"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName returns the table of the records
+func (Record) TableName() string {
+	return "idempotency_keys"
+}
@@ -0,0 +1,108 @@
+package jwt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/labstack/echo/v4"
+)
+
+// ClaimsKey is the key of the typed claims in the echo context and the request context
+const ClaimsKey Key = "X-User-Claims"
+
+// DefaultLeeway is the default clock skew allowed when validating exp, nbf and iat
+const DefaultLeeway = 30 * time.Second
+
+// registeredClaimNames are the claims of RegisteredClaims, not kept in Extra
+var registeredClaimNames = []string{"iss", "sub", "aud", "exp", "nbf", "iat", "jti"}
+
+// Claims represents the claims of the access tokens
+type Claims struct {
+	UserID   int      `json:"id,omitempty"`
+	Role     string   `json:"role,omitempty"`
+	BranchID int      `json:"branch_id,omitempty"`
+	Scopes   []string `json:"scopes,omitempty"`
+	jwt.RegisteredClaims
+	// Extra holds the other claims of the token
+	Extra map[string]interface{} `json:"-"`
+}
+
+// NewClaims converts the map claims to typed claims. The OAuth "scope" claim, space separated, is merged into Scopes.
+func NewClaims(m jwt.MapClaims) (*Claims, error) {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	claims := new(Claims)
+	if err := json.Unmarshal(b, claims); err != nil {
+		return nil, fmt.Errorf("invalid claims: %w", err)
+	}
+	if scope, ok := m["scope"].(string); ok {
+		claims.Scopes = append(claims.Scopes, strings.Fields(scope)...)
+	}
+
+	claims.Extra = make(map[string]interface{})
+	for k, v := range m {
+		claims.Extra[k] = v
+	}
+	for _, k := range append(registeredClaimNames, "id", "role", "branch_id", "scopes", "scope") {
+		delete(claims.Extra, k)
+	}
+	return claims, nil
+}
+
+// ClaimsFromContext returns the claims of the authenticated request, e.g. in services receiving the request context
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(ClaimsKey).(*Claims)
+	return claims, ok && claims != nil
+}
+
+// GetClaims returns the claims of the authenticated request in echo handlers
+func GetClaims(c echo.Context) (*Claims, bool) {
+	claims, ok := c.Get(string(ClaimsKey)).(*Claims)
+	return claims, ok && claims != nil
+}
+
+// ParseClaims parses and validates the token, e.g. a token received through websocket messages
+func (j *Service) ParseClaims(input string) (*Claims, error) {
+	token, err := j.parseToken(input)
+	if err != nil {
+		return nil, err
+	}
+	return NewClaims(token.Claims.(jwt.MapClaims))
+}
+
+// validateClaims validates the registered claims allowing the clock skew of the config,
+// and the issuer and audience when they are configured
+func (j *Service) validateClaims(claims jwt.MapClaims) error {
+	leeway := j.cfg.Leeway
+	if leeway == 0 {
+		leeway = DefaultLeeway
+	}
+	now := time.Now()
+	if !claims.VerifyExpiresAt(now.Add(-leeway).Unix(), false) {
+		return fmt.Errorf("token is expired")
+	}
+	if !claims.VerifyNotBefore(now.Add(leeway).Unix(), false) {
+		return fmt.Errorf("token is not valid yet")
+	}
+	if !claims.VerifyIssuedAt(now.Add(leeway).Unix(), false) {
+		return fmt.Errorf("token used before issued")
+	}
+	if j.cfg.Issuer != "" && !claims.VerifyIssuer(j.cfg.Issuer, true) {
+		return fmt.Errorf("token issuer mismatched")
+	}
+	if len(j.cfg.Audience) > 0 {
+		for _, aud := range j.cfg.Audience {
+			if claims.VerifyAudience(aud, true) {
+				return nil
+			}
+		}
+		return fmt.Errorf("token audience mismatched")
+	}
+	return nil
+}
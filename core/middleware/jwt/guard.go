@@ -0,0 +1,70 @@
+package jwt
+
+import (
+	"github.com/namhoai1109/tabi/core/rbac"
+	"github.com/namhoai1109/tabi/core/server"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HasRole reports whether the role of the claims is one of the roles
+func (c *Claims) HasRole(roles ...string) bool {
+	for _, role := range roles {
+		if c.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScopes reports whether the claims have all the scopes
+func (c *Claims) HasScopes(scopes ...string) bool {
+	for _, scope := range scopes {
+		found := false
+		for _, s := range c.Scopes {
+			if s == scope {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// RequireRoles allows the requests whose role is one of the roles, e.g.
+//
+//	g := e.Group("/branches", jwtSvc.MiddlewareFunction(), jwt.RequireRoles(httpcore.BranchManagerRole, httpcore.RepresentativeRole))
+//
+// The JWT middleware must be executed before.
+func RequireRoles(roles ...string) echo.MiddlewareFunc {
+	return requireClaims(func(claims *Claims) bool {
+		return claims.HasRole(roles...)
+	})
+}
+
+// RequireScopes allows the requests having all the scopes, e.g. jwt.RequireScopes("booking:write").
+// The JWT middleware must be executed before.
+func RequireScopes(scopes ...string) echo.MiddlewareFunc {
+	return requireClaims(func(claims *Claims) bool {
+		return claims.HasScopes(scopes...)
+	})
+}
+
+// requireClaims responds rbac.ErrForbiddenAccess when the claims are not allowed
+func requireClaims(allowed func(claims *Claims) bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			claims, ok := GetClaims(c)
+			if !ok {
+				return server.NewHTTPAuthorizationError("Your session is unauthorized or has expired.")
+			}
+			if !allowed(claims) {
+				return rbac.ErrForbiddenAccess
+			}
+			return next(c)
+		}
+	}
+}
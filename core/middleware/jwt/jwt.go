@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/namhoai1109/tabi/core/logger"
+	"github.com/namhoai1109/tabi/core/middleware/apikey"
+	"github.com/namhoai1109/tabi/core/middleware/logadapter"
+	"github.com/namhoai1109/tabi/core/secret"
 	"github.com/namhoai1109/tabi/core/server"
 
-	"github.com/aws/aws-secretsmanager-caching-go/secretcache"
 	jwt "github.com/golang-jwt/jwt/v4"
 	"github.com/labstack/echo/v4"
 )
@@ -24,114 +27,197 @@ type BasicTokenData struct {
 	Password string `json:"password"`
 }
 
-// New generates new JWT service necessery for auth middleware
+// New generates new JWT service necessery for auth middleware.
+// The secret is the PEM encoded private key for RSA, ECDSA and EdDSA algorithms.
 func New(algo, secret string, duration int) *Service {
-	signingMethod := jwt.GetSigningMethod(algo)
-	if signingMethod == nil {
-		panic("invalid jwt signing method")
-	}
 	return &Service{
-		algo:     signingMethod,
-		key:      []byte(secret),
+		keys:     NewKeySet(mustKeyFromSecret(algo, secret)),
 		duration: time.Duration(duration) * time.Second,
+		lookups:  mustTokenLookup(DefaultTokenLookup),
 	}
 }
 
 // NewWithConfig generates new JWT service with config necessery for auth middleware
 func NewWithConfig(algo, secret string, duration int, config JWTConfig) *Service {
-	signingMethod := jwt.GetSigningMethod(algo)
-	if signingMethod == nil {
+	return NewWithKeySet(NewKeySet(mustKeyFromSecret(algo, secret)), duration, config)
+}
+
+// NewWithKeySet generates new JWT service signing with the current key of the key set,
+// e.g. to rotate keys or to verify tokens of other services using NewKeySetFromJWKS
+func NewWithKeySet(keys *KeySet, duration int, config JWTConfig) *Service {
+	return &Service{
+		keys:     keys,
+		duration: time.Duration(duration) * time.Second,
+		cfg:      config,
+		denylist: config.Denylist,
+		lookups:  mustTokenLookup(config.TokenLookup),
+	}
+}
+
+func mustKeyFromSecret(algo, secret string) *SigningKey {
+	if jwt.GetSigningMethod(algo) == nil {
 		panic("invalid jwt signing method")
 	}
-	secretCache, err := secretcache.New()
+	key, err := newKeyFromSecret(algo, secret)
 	if err != nil {
-		fmt.Errorf("failed to new secretCache with err: %v", err)
-	}
-	return &Service{
-		algo:        signingMethod,
-		key:         []byte(secret),
-		duration:    time.Duration(duration) * time.Second,
-		cfg:         config,
-		secretCache: secretCache,
+		panic(fmt.Sprintf("invalid jwt key: %v", err))
 	}
+	return key
 }
 
 // JWTConfig represents config for JWT
 type JWTConfig struct {
 	SecretIDBasicToken string
 	Role               string
+	// SecretProvider provides the basic token secret, default is secret.Default()
+	SecretProvider secret.Provider
+	// APIKeys verifies the API keys of the X-API-Key header, and the basic auth passwords
+	// of the clients instead of the basic token secret
+	APIKeys *apikey.Service
+	// Denylist rejects the revoked access tokens by jti, it is set by NewSessionManager when nil
+	Denylist Denylist
+	// Issuer is set as iss claim of the generated tokens and required on the parsed tokens when not empty
+	Issuer string
+	// Audience is set as aud claim of the generated tokens, the parsed tokens must have one of them when not empty
+	Audience []string
+	// Leeway is the clock skew allowed when validating exp, nbf and iat claims, default is DefaultLeeway
+	Leeway time.Duration
+	// TokenLookup is the comma separated sources of the token in order of lookup,
+	// e.g. "header:Authorization,cookie:access_token,query:token". Default is DefaultTokenLookup
+	TokenLookup string
+	// QueryTokenMaxAge is the max age of the tokens from query by their iat claim, default is DefaultQueryTokenMaxAge.
+	// Generate short-lived tokens for websocket and download links.
+	QueryTokenMaxAge time.Duration
+	// CSRFCookie and CSRFHeader are the names of the CSRF double-submit token, required on unsafe methods
+	// when the token is from cookie. Default are DefaultCSRFCookie and DefaultCSRFHeader
+	CSRFCookie string
+	CSRFHeader string
+}
+
+// Keys returns the key set of the service, e.g. to rotate the signing key
+func (j *Service) Keys() *KeySet {
+	return j.keys
 }
 
 // Service provides a Json-Web-Token authentication implementation
 type Service struct {
-	// Secret key used for signing.
-	key []byte
+	// Keys used for signing and verification.
+	keys *KeySet
 	// Duration (in seconds) for which the jwt token is valid.
 	duration time.Duration
-	// Service signing algorithm
-	algo jwt.SigningMethod
 	// Config
 	cfg JWTConfig
-	// Secret manager
-	secretCache *secretcache.Cache
+	// Revoked access tokens
+	denylist Denylist
+	// Sources of the token
+	lookups []tokenLookup
 }
 
 // MiddlewareFunction makes JWT implement the Middleware interface.
 func (j *Service) MiddlewareFunction(services ...*Service) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			token, err := j.parseTokenFromHeader(c)
-			if err != nil || !token.Valid {
+			token, err := j.authenticate(c)
+			if err != nil {
 				for _, svc := range services {
 					if svc == nil {
 						continue
 					}
-					t, svcErr := svc.parseTokenFromHeader(c)
-					if svcErr != nil || !t.Valid {
+					t, svcErr := svc.authenticate(c)
+					if svcErr != nil {
 						continue
 					}
-					claims := t.Claims.(jwt.MapClaims)
-					info := make(map[string]interface{})
-					for key, val := range claims {
-						c.Set(key, val)
-						info[key] = val
-					}
-					ctx := c.Request().Context()
-					ctx = context.WithValue(ctx, USER_INFO_KEY, info)
-					request := c.Request().WithContext(ctx)
-					c.SetRequest(request)
+					setClaims(c, t.Claims.(jwt.MapClaims))
 					return next(c)
 				}
-				if err != nil {
-					fmt.Errorf("error parsing token: %+v", err)
-				}
+				logger.LogDebug(c.Request().Context(), fmt.Sprintf("error parsing token: %v", err))
 				return server.NewHTTPAuthorizationError("Your session is unauthorized or has expired.")
 			}
-			claims := token.Claims.(jwt.MapClaims)
-			info := make(map[string]interface{})
-			for key, val := range claims {
-				c.Set(key, val)
-				info[key] = val
-			}
-			ctx := c.Request().Context()
-			ctx = context.WithValue(ctx, USER_INFO_KEY, info)
-			request := c.Request().WithContext(ctx)
-			c.SetRequest(request)
+			setClaims(c, token.Claims.(jwt.MapClaims))
 			return next(c)
 		}
 	}
 }
 
-// GenerateToken generates new Service token and populates it with user data
+// authenticate parses the token of the request, rejecting the invalid and revoked tokens
+func (j *Service) authenticate(c echo.Context) (*jwt.Token, error) {
+	token, err := j.parseTokenFromRequest(c)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, fmt.Errorf("token invalid")
+	}
+	if j.denylist == nil {
+		return token, nil
+	}
+	jti, _ := token.Claims.(jwt.MapClaims)["jti"].(string)
+	if jti == "" {
+		return token, nil
+	}
+	revoked, err := j.denylist.IsRevoked(c.Request().Context(), jti)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check revoked token: %w", err)
+	}
+	if revoked {
+		return nil, fmt.Errorf("token revoked")
+	}
+	return token, nil
+}
+
+// setClaims stores the raw claims and the typed claims in the echo context and the request context.
+// The typed claims are skipped when the claims have unexpected types, e.g. a string "id",
+// so such tokens are still accepted with the raw claims but GetClaims and the guards reject them.
+func setClaims(c echo.Context, claims jwt.MapClaims) {
+	typed, err := NewClaims(claims)
+	if err != nil {
+		logger.LogDebug(c.Request().Context(), fmt.Sprintf("error parsing claims: %v", err))
+	}
+	info := make(map[string]interface{})
+	for key, val := range claims {
+		c.Set(key, val)
+		info[key] = val
+	}
+	ctx := c.Request().Context()
+	if typed != nil {
+		c.Set(string(ClaimsKey), typed)
+		ctx = context.WithValue(ctx, ClaimsKey, typed)
+	}
+	ctx = context.WithValue(ctx, USER_INFO_KEY, info)
+	ctx = context.WithValue(ctx, logadapter.UserInfoKey, info)
+	c.SetRequest(c.Request().WithContext(ctx))
+}
+
+// GenerateToken generates new Service token and populates it with user data.
+// The jti (token ID) and iat claims are set unless given, so the token can be revoked.
 func (j *Service) GenerateToken(claims map[string]interface{}, expire *time.Time) (string, int, error) {
 	if expire == nil {
 		expTime := time.Now().Add(j.duration)
 		expire = &expTime
 	}
 	claims["exp"] = expire.Unix()
+	if _, ok := claims["jti"]; !ok {
+		claims["jti"] = logadapter.NewID()
+	}
+	if _, ok := claims["iat"]; !ok {
+		claims["iat"] = time.Now().Unix()
+	}
+	if _, ok := claims["iss"]; !ok && j.cfg.Issuer != "" {
+		claims["iss"] = j.cfg.Issuer
+	}
+	if _, ok := claims["aud"]; !ok && len(j.cfg.Audience) > 0 {
+		claims["aud"] = j.cfg.Audience
+	}
 
-	token := jwt.NewWithClaims(j.algo, jwt.MapClaims(claims))
-	tokenString, err := token.SignedString(j.key)
+	key := j.keys.Current()
+	if key == nil || key.Private == nil {
+		return "", 0, fmt.Errorf("no signing key")
+	}
+	token := jwt.NewWithClaims(key.Method, jwt.MapClaims(claims))
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
+	}
+	tokenString, err := token.SignedString(key.Private)
 
 	return tokenString, int(time.Until(*expire).Seconds()), err
 }
@@ -0,0 +1,298 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"sync"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/labstack/echo/v4"
+)
+
+// JWKSPath is the well-known path publishing the public keys, e.g. e.GET(jwt.JWKSPath, jwtSvc.JWKSHandler())
+const JWKSPath = "/.well-known/jwks.json"
+
+// SigningKey is a key identified by the kid header of the tokens
+type SigningKey struct {
+	// ID is sent as kid header of the tokens signed by the key
+	ID     string
+	Method jwt.SigningMethod
+	// Private signs the tokens, []byte for HMAC, *rsa.PrivateKey, *ecdsa.PrivateKey or ed25519.PrivateKey.
+	// It is nil for the keys which only verify the tokens.
+	Private interface{}
+	// Public verifies the tokens, same as Private for HMAC
+	Public interface{}
+}
+
+// NewHMACKey creates new HMAC key (HS256, HS384, HS512) from the secret
+func NewHMACKey(kid, algo, secret string) (*SigningKey, error) {
+	method, ok := jwt.GetSigningMethod(algo).(*jwt.SigningMethodHMAC)
+	if !ok {
+		return nil, fmt.Errorf("invalid hmac signing method %s", algo)
+	}
+	return &SigningKey{ID: kid, Method: method, Private: []byte(secret), Public: []byte(secret)}, nil
+}
+
+// NewKeyFromPEM creates new RSA (RS*, PS*), ECDSA (ES*) or EdDSA key from the PEM encoded private key,
+// or from the public key for the keys which only verify the tokens
+func NewKeyFromPEM(kid, algo string, data []byte) (*SigningKey, error) {
+	method := jwt.GetSigningMethod(algo)
+	key := &SigningKey{ID: kid, Method: method}
+	var err error
+	switch method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		var priv *rsa.PrivateKey
+		if priv, err = jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+			key.Private, key.Public = priv, &priv.PublicKey
+		} else if key.Public, err = jwt.ParseRSAPublicKeyFromPEM(data); err != nil {
+			return nil, err
+		}
+	case *jwt.SigningMethodECDSA:
+		var priv *ecdsa.PrivateKey
+		if priv, err = jwt.ParseECPrivateKeyFromPEM(data); err == nil {
+			key.Private, key.Public = priv, &priv.PublicKey
+		} else if key.Public, err = jwt.ParseECPublicKeyFromPEM(data); err != nil {
+			return nil, err
+		}
+	case *jwt.SigningMethodEd25519:
+		var priv crypto.PrivateKey
+		if priv, err = jwt.ParseEdPrivateKeyFromPEM(data); err == nil {
+			key.Private, key.Public = priv, priv.(ed25519.PrivateKey).Public()
+		} else if key.Public, err = jwt.ParseEdPublicKeyFromPEM(data); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid asymmetric signing method %s", algo)
+	}
+	return key, nil
+}
+
+// newKeyFromSecret creates the key of New and NewWithConfig, the secret is PEM encoded for asymmetric algorithms
+func newKeyFromSecret(algo, secret string) (*SigningKey, error) {
+	if _, ok := jwt.GetSigningMethod(algo).(*jwt.SigningMethodHMAC); ok {
+		return NewHMACKey("", algo, secret)
+	}
+	return NewKeyFromPEM("", algo, []byte(secret))
+}
+
+// KeySet holds the current signing key and the keys still accepted for verification.
+// To rotate keys without logging everyone out, Rotate to the new key and Remove the old one
+// after the longest token duration has passed.
+type KeySet struct {
+	mu      sync.RWMutex
+	current *SigningKey
+	keys    map[string]*SigningKey
+}
+
+// NewKeySet creates new key set signing with the current key and verifying with all the keys
+func NewKeySet(current *SigningKey, others ...*SigningKey) *KeySet {
+	ks := &KeySet{keys: make(map[string]*SigningKey)}
+	for _, key := range others {
+		ks.keys[key.ID] = key
+	}
+	ks.Rotate(current)
+	return ks
+}
+
+// Rotate signs the tokens with the key from now on, the previous keys are still accepted for verification
+func (ks *KeySet) Rotate(key *SigningKey) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.current = key
+	ks.keys[key.ID] = key
+}
+
+// Add accepts the tokens signed by the key, e.g. the next key published before rotating
+func (ks *KeySet) Add(key *SigningKey) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.keys[key.ID] = key
+}
+
+// Remove stops accepting the tokens signed by the key, the current key cannot be removed
+func (ks *KeySet) Remove(kid string) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if ks.current != nil && ks.current.ID == kid {
+		return
+	}
+	delete(ks.keys, kid)
+}
+
+// Current returns the key signing the tokens
+func (ks *KeySet) Current() *SigningKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.current
+}
+
+// Key returns the key of the kid. Tokens without kid, issued before key sets, are verified
+// by the key without ID, e.g. the secret of New, or by the current key.
+func (ks *KeySet) Key(kid string) (*SigningKey, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	key, ok := ks.keys[kid]
+	if !ok && kid == "" && ks.current != nil {
+		return ks.current, true
+	}
+	return key, ok
+}
+
+// keyFunc returns the verification key of the token, checking the algorithm matches the key
+func (ks *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.Key(kid)
+	if !ok {
+		return nil, fmt.Errorf("token key %q not found", kid)
+	}
+	if key.Method.Alg() != token.Method.Alg() {
+		return nil, fmt.Errorf("token method mismatched")
+	}
+	return key.Public, nil
+}
+
+// JWK represents a public key as JSON Web Key (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKSet represents a JSON Web Key Set
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the set, HMAC keys are secret and never published
+func (ks *KeySet) JWKS() JWKSet {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		if jwk, ok := newJWK(key); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	sort.Slice(set.Keys, func(i, k int) bool { return set.Keys[i].Kid < set.Keys[k].Kid })
+	return set
+}
+
+func newJWK(key *SigningKey) (JWK, bool) {
+	enc := base64.RawURLEncoding
+	jwk := JWK{Kid: key.ID, Alg: key.Method.Alg(), Use: "sig"}
+	switch pub := key.Public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = enc.EncodeToString(pub.N.Bytes())
+		jwk.E = enc.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = pub.Curve.Params().Name
+		jwk.X = enc.EncodeToString(pub.X.FillBytes(make([]byte, size)))
+		jwk.Y = enc.EncodeToString(pub.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = enc.EncodeToString(pub)
+	default:
+		return jwk, false
+	}
+	return jwk, true
+}
+
+// NewKeySetFromJWKS creates new key set verifying the tokens with the published keys of another service.
+// The set has no current key, so it cannot sign tokens.
+func NewKeySetFromJWKS(data []byte) (*KeySet, error) {
+	set := new(JWKSet)
+	if err := json.Unmarshal(data, set); err != nil {
+		return nil, err
+	}
+	ks := &KeySet{keys: make(map[string]*SigningKey)}
+	for _, jwk := range set.Keys {
+		pub, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid jwk %s: %w", jwk.Kid, err)
+		}
+		method := jwt.GetSigningMethod(jwk.Alg)
+		if method == nil {
+			return nil, fmt.Errorf("invalid jwk %s: unknown alg %s", jwk.Kid, jwk.Alg)
+		}
+		ks.keys[jwk.Kid] = &SigningKey{ID: jwk.Kid, Method: method, Public: pub}
+	}
+	return ks, nil
+}
+
+func (jwk JWK) publicKey() (interface{}, error) {
+	dec := base64.RawURLEncoding
+	switch jwk.Kty {
+	case "RSA":
+		n, err := dec.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := dec.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unknown curve %s", jwk.Crv)
+		}
+		x, err := dec.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := dec.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unknown curve %s", jwk.Crv)
+		}
+		x, err := dec.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unknown kty %s", jwk.Kty)
+	}
+}
+
+// JWKSHandler publishes the public keys of the service as JWKS, e.g. e.GET(jwt.JWKSPath, jwtSvc.JWKSHandler())
+func (j *Service) JWKSHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.Response().Header().Set(echo.HeaderCacheControl, "public, max-age=300")
+		return c.JSON(http.StatusOK, j.keys.JWKS())
+	}
+}
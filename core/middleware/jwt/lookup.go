@@ -0,0 +1,176 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/labstack/echo/v4"
+)
+
+// Token sources
+const (
+	SourceHeader = "header"
+	SourceCookie = "cookie"
+	SourceQuery  = "query"
+)
+
+// Defaults of the token lookup
+const (
+	DefaultTokenLookup      = "header:Authorization"
+	DefaultQueryTokenMaxAge = 5 * time.Minute
+	DefaultCSRFCookie       = "csrf_token"
+	DefaultCSRFHeader       = "X-CSRF-Token"
+)
+
+// tokenLookup is a source of the token, e.g. cookie:access_token
+type tokenLookup struct {
+	source string
+	name   string
+}
+
+// parseTokenLookup parses the comma separated sources of the token, e.g. "header:Authorization,cookie:access_token"
+func parseTokenLookup(s string) ([]tokenLookup, error) {
+	if s == "" {
+		s = DefaultTokenLookup
+	}
+	var lookups []tokenLookup
+	for _, part := range strings.Split(s, ",") {
+		source, name, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid token lookup %q", part)
+		}
+		switch source {
+		case SourceHeader, SourceCookie, SourceQuery:
+			lookups = append(lookups, tokenLookup{source: source, name: name})
+		default:
+			return nil, fmt.Errorf("invalid token source %q", source)
+		}
+	}
+	return lookups, nil
+}
+
+func mustTokenLookup(s string) []tokenLookup {
+	lookups, err := parseTokenLookup(s)
+	if err != nil {
+		panic(err.Error())
+	}
+	return lookups
+}
+
+// extract returns the raw token of the source, empty when the request has none
+func (l tokenLookup) extract(c echo.Context) (string, error) {
+	req := c.Request()
+	switch l.source {
+	case SourceCookie:
+		cookie, err := req.Cookie(l.name)
+		if err != nil {
+			return "", nil
+		}
+		return cookie.Value, nil
+	case SourceQuery:
+		return c.QueryParam(l.name), nil
+	default:
+		token := req.Header.Get(l.name)
+		if token == "" {
+			return "", nil
+		}
+		parts := strings.SplitN(token, " ", 2)
+		if len(parts) == 2 && strings.ToLower(parts[0]) == "bearer" {
+			return parts[1], nil
+		}
+		if strings.EqualFold(l.name, echo.HeaderAuthorization) {
+			return "", fmt.Errorf("token invalid")
+		}
+		return token, nil
+	}
+}
+
+// checkSource applies the protections of the token source:
+// CSRF double-submit for cookies on unsafe methods and max age for query tokens
+func (j *Service) checkSource(c echo.Context, source string, token *jwt.Token) error {
+	switch source {
+	case SourceCookie:
+		switch c.Request().Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return nil
+		}
+		cookie, err := c.Request().Cookie(j.csrfCookie())
+		if err != nil || cookie.Value == "" {
+			return fmt.Errorf("csrf token not found")
+		}
+		header := c.Request().Header.Get(j.csrfHeader())
+		if subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) != 1 {
+			return fmt.Errorf("csrf token mismatched")
+		}
+	case SourceQuery:
+		maxAge := j.cfg.QueryTokenMaxAge
+		if maxAge <= 0 {
+			maxAge = DefaultQueryTokenMaxAge
+		}
+		iat, ok := token.Claims.(jwt.MapClaims)["iat"].(float64)
+		if !ok || time.Since(time.Unix(int64(iat), 0)) > maxAge {
+			return fmt.Errorf("query token too old")
+		}
+	}
+	return nil
+}
+
+func (j *Service) csrfCookie() string {
+	if j.cfg.CSRFCookie != "" {
+		return j.cfg.CSRFCookie
+	}
+	return DefaultCSRFCookie
+}
+
+func (j *Service) csrfHeader() string {
+	if j.cfg.CSRFHeader != "" {
+		return j.cfg.CSRFHeader
+	}
+	return DefaultCSRFHeader
+}
+
+// SetTokenCookie sets the token as HttpOnly cookie of the first cookie source of the token lookup,
+// along with the CSRF cookie readable by the web app, which sends it back in the CSRF header
+func (j *Service) SetTokenCookie(c echo.Context, token string, expiresIn int) error {
+	name := ""
+	for _, l := range j.lookups {
+		if l.source == SourceCookie {
+			name = l.name
+			break
+		}
+	}
+	if name == "" {
+		return fmt.Errorf("token lookup has no cookie source")
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	expires := time.Now().Add(time.Duration(expiresIn) * time.Second)
+	c.SetCookie(&http.Cookie{
+		Name: name, Value: token, Path: "/", Expires: expires,
+		HttpOnly: true, Secure: true, SameSite: http.SameSiteLaxMode,
+	})
+	c.SetCookie(&http.Cookie{
+		Name: j.csrfCookie(), Value: base64.RawURLEncoding.EncodeToString(b), Path: "/", Expires: expires,
+		Secure: true, SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// ClearTokenCookie deletes the token and CSRF cookies, e.g. on logout
+func (j *Service) ClearTokenCookie(c echo.Context) {
+	for _, l := range j.lookups {
+		if l.source == SourceCookie {
+			c.SetCookie(&http.Cookie{Name: l.name, Path: "/", MaxAge: -1, HttpOnly: true, Secure: true})
+		}
+	}
+	c.SetCookie(&http.Cookie{Name: j.csrfCookie(), Path: "/", MaxAge: -1, Secure: true})
+}
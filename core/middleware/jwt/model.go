@@ -0,0 +1,59 @@
+package jwt
+
+import "time"
+
+// Session represents a login of the subject on a device, i.e. a family of rotated refresh tokens,
+// it can be used to migrate the tables, e.g. db.AutoMigrate(&jwt.Session{}, &jwt.RefreshToken{}, &jwt.RevokedToken{})
+type Session struct {
+	ID int `json:"id" gorm:"primaryKey"`
+	// Subject is the owner of the session, e.g. the user ID
+	Subject    string `json:"subject" gorm:"type:varchar(255);not null;index"`
+	DeviceID   string `json:"device_id" gorm:"type:varchar(255)"`
+	DeviceName string `json:"device_name" gorm:"type:varchar(255)"`
+	UserAgent  string `json:"user_agent" gorm:"type:text"`
+	IP         string `json:"ip" gorm:"type:varchar(64)"`
+	// Claims are the claims of the access tokens, in JSON
+	Claims string `json:"-" gorm:"type:text"`
+	// AccessJTI is the jti of the latest access token, revoked with the session
+	AccessJTI       string    `json:"-" gorm:"type:varchar(64)"`
+	AccessExpiresAt time.Time `json:"-"`
+
+	LastUsedAt time.Time  `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"index"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// TableName returns the table of the sessions
+func (Session) TableName() string {
+	return "auth_sessions"
+}
+
+// RefreshToken represents a refresh token of a session, only the hash of the token is stored
+type RefreshToken struct {
+	ID        int    `json:"id" gorm:"primaryKey"`
+	SessionID int    `json:"session_id" gorm:"not null;index"`
+	TokenHash string `json:"-" gorm:"type:varchar(64);not null;uniqueIndex"`
+	// UsedAt is set when the token is rotated, using it again revokes the session
+	UsedAt    *time.Time `json:"used_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TableName returns the table of the refresh tokens
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
+
+// RevokedToken represents a revoked access token, kept until it expires
+type RevokedToken struct {
+	JTI       string    `json:"jti" gorm:"type:varchar(64);primaryKey"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName returns the table of the revoked tokens
+func (RevokedToken) TableName() string {
+	return "revoked_tokens"
+}
@@ -2,70 +2,120 @@ package jwt
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/subtle"
 	"fmt"
-	"strings"
+
+	"github.com/namhoai1109/tabi/core/logger"
+	"github.com/namhoai1109/tabi/core/middleware/apikey"
+	"github.com/namhoai1109/tabi/core/secret"
 
 	jwt "github.com/golang-jwt/jwt/v4"
 	"github.com/labstack/echo/v4"
 )
 
-// ParseTokenFromHeader parses token from Authorization header
-func (j *Service) parseTokenFromHeader(c echo.Context) (*jwt.Token, error) {
+// ParseTokenFromRequest parses token from the first source of the token lookup having it
+func (j *Service) parseTokenFromRequest(c echo.Context) (*jwt.Token, error) {
+	// Verify API key
+	if key := c.Request().Header.Get(apikey.HeaderAPIKey); key != "" && j.cfg.APIKeys != nil {
+		return j.parseAPIKey(c.Request().Context(), "", key)
+	}
+
 	// Verify basic token
 	username, password, okBasic := c.Request().BasicAuth()
 	if okBasic {
+		if j.cfg.APIKeys != nil {
+			return j.parseAPIKey(c.Request().Context(), username, password)
+		}
 		return j.parseBasicToken(c.Request().Context(), username, password)
 	}
 
 	// Verify JWT
-	token := c.Request().Header.Get("Authorization")
-	if token == "" {
-		return nil, fmt.Errorf("token not found")
+	for _, l := range j.lookups {
+		input, err := l.extract(c)
+		if err != nil {
+			return nil, err
+		}
+		if input == "" {
+			continue
+		}
+		token, err := j.parseToken(input)
+		if err != nil {
+			return nil, err
+		}
+		if err := j.checkSource(c, l.source, token); err != nil {
+			return nil, err
+		}
+		return token, nil
 	}
-	parts := strings.SplitN(token, " ", 2)
-	if !(len(parts) == 2 && strings.ToLower(parts[0]) == "bearer") {
+	return nil, fmt.Errorf("token not found")
+}
+
+// ParseToken parses token from string, validating the claims with clock skew
+func (j *Service) parseToken(input string) (*jwt.Token, error) {
+	token, err := jwt.NewParser(jwt.WithoutClaimsValidation()).Parse(input, j.keys.keyFunc)
+	if err != nil {
+		return nil, err
+	}
+	if err := j.validateClaims(token.Claims.(jwt.MapClaims)); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// ParseAPIKey returns token with the claims of the API key, the client name must match when given
+func (j *Service) parseAPIKey(ctx context.Context, name, input string) (*jwt.Token, error) {
+	key, err := j.cfg.APIKeys.Verify(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	if name != "" && subtle.ConstantTimeCompare([]byte(name), []byte(key.Name)) != 1 {
 		return nil, fmt.Errorf("token invalid")
 	}
 
-	return j.parseToken(parts[1])
+	claims := jwt.MapClaims{
+		"sub":    "apikey:" + key.Name,
+		"client": key.Name,
+	}
+	if key.Role != "" {
+		claims["role"] = key.Role
+	}
+	if len(key.Scopes) > 0 {
+		claims["scopes"] = key.Scopes
+	}
+	return &jwt.Token{Valid: true, Claims: claims}, nil
 }
 
-// ParseToken parses token from string
-func (j *Service) parseToken(input string) (*jwt.Token, error) {
-	return jwt.Parse(input, func(token *jwt.Token) (interface{}, error) {
-		if j.algo != token.Method {
-			return nil, fmt.Errorf("token method mismatched")
-		}
-		return j.key, nil
-	})
+// matches compares the credentials in constant time
+func (b *BasicTokenData) matches(username, password string) bool {
+	userOK := subtle.ConstantTimeCompare([]byte(username), []byte(b.UserName)) == 1
+	passOK := subtle.ConstantTimeCompare([]byte(password), []byte(b.Password)) == 1
+	return userOK && passOK
 }
 
 // ParseBasicToken return token with claim of Backend ID
 func (j *Service) parseBasicToken(ctx context.Context, username, password string) (*jwt.Token, error) {
-	if j.secretCache == nil {
-		fmt.Println("secretCache is nil. cannot use basic token")
+	if j.cfg.SecretIDBasicToken == "" {
+		logger.LogDebug(ctx, "basic token secret is not configured. cannot use basic token")
 		return nil, fmt.Errorf("token invalid")
 	}
 
-	basicTokenStr, err := j.secretCache.GetSecretString(j.cfg.SecretIDBasicToken)
-	if err != nil {
-		return nil, err
+	provider := j.cfg.SecretProvider
+	if provider == nil {
+		provider = secret.Default()
 	}
 	basicToken := new(BasicTokenData)
-	err = json.Unmarshal([]byte(basicTokenStr), &basicToken)
-	if err != nil {
+	if err := secret.GetJSON(ctx, provider, j.cfg.SecretIDBasicToken, basicToken); err != nil {
 		return nil, err
 	}
-
-	if username != basicToken.UserName {
-		fmt.Println("basic token invalid")
-		return nil, fmt.Errorf("token invalid")
-	}
-
-	if password != basicToken.Password {
-		fmt.Println("basic token invalid")
-		return nil, fmt.Errorf("token invalid")
+	if !basicToken.matches(username, password) {
+		// the secret may have been rotated since it was cached
+		if err := secret.RefreshJSON(ctx, provider, j.cfg.SecretIDBasicToken, basicToken); err != nil {
+			return nil, err
+		}
+		if !basicToken.matches(username, password) {
+			logger.LogDebug(ctx, "basic token invalid")
+			return nil, fmt.Errorf("token invalid")
+		}
 	}
 
 	token := &jwt.Token{
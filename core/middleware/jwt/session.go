@@ -0,0 +1,376 @@
+package jwt
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	dbcore "github.com/namhoai1109/tabi/core/db"
+	"github.com/namhoai1109/tabi/core/logger"
+	"github.com/namhoai1109/tabi/core/middleware/logadapter"
+	"github.com/namhoai1109/tabi/core/server"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// HeaderDeviceID identifies the device of the session, sent by the mobile apps
+const HeaderDeviceID = "X-Device-ID"
+
+// Session errors
+var (
+	ErrInvalidRefreshToken = server.NewHTTPAuthorizationError("Your session is unauthorized or has expired.")
+	ErrRefreshTokenReused  = server.NewHTTPAuthorizationError("Your session has been revoked, please log in again.")
+)
+
+// Denylist holds the revoked access tokens by jti until they expire
+type Denylist interface {
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+	Revoke(ctx context.Context, jti string, expiresAt time.Time) error
+}
+
+// PostgresDenylist keeps the revoked access tokens in the revoked_tokens table
+type PostgresDenylist struct {
+	db *gorm.DB
+}
+
+// NewPostgresDenylist creates new Postgres denylist
+func NewPostgresDenylist(db *gorm.DB) *PostgresDenylist {
+	return &PostgresDenylist{db: db}
+}
+
+// IsRevoked implements Denylist
+func (d *PostgresDenylist) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	return dbcore.NewDB(&RevokedToken{}).Exist(d.db.WithContext(ctx), "jti = ? AND expires_at > ?", jti, time.Now())
+}
+
+// Revoke implements Denylist
+func (d *PostgresDenylist) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	return revokeToken(d.db.WithContext(ctx), jti, expiresAt)
+}
+
+func revokeToken(db *gorm.DB, jti string, expiresAt time.Time) error {
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&RevokedToken{JTI: jti, ExpiresAt: expiresAt}).Error
+}
+
+// SessionConfig represents the config of the session manager
+type SessionConfig struct {
+	// DB stores the sessions, refresh tokens and revoked access tokens
+	DB *gorm.DB
+	// RefreshTTL is the lifetime of a session without refreshing, default is 30 days
+	RefreshTTL time.Duration
+	// ClaimsFunc returns the claims of the access tokens issued on refresh, e.g. to reload the role of the user.
+	// Default reuses the claims of the login.
+	ClaimsFunc func(ctx context.Context, subject string) (map[string]interface{}, error)
+}
+
+// DefaultSessionConfig is the default session manager config
+var DefaultSessionConfig = SessionConfig{
+	RefreshTTL: 30 * 24 * time.Hour,
+}
+
+// Device describes the device of a session
+type Device struct {
+	ID        string
+	Name      string
+	UserAgent string
+	IP        string
+}
+
+// DeviceFromRequest returns the device of the request, identified by the X-Device-ID header
+func DeviceFromRequest(c echo.Context) Device {
+	return Device{
+		ID:        c.Request().Header.Get(HeaderDeviceID),
+		UserAgent: c.Request().UserAgent(),
+		IP:        c.RealIP(),
+	}
+}
+
+// TokenPair is the access token and the refresh token issued on login and refresh
+type TokenPair struct {
+	AccessToken      string `json:"access_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	RefreshToken     string `json:"refresh_token"`
+	RefreshExpiresIn int    `json:"refresh_expires_in"`
+}
+
+// SessionManager issues and rotates refresh tokens, one session per login of each device.
+// Refresh tokens are opaque and rotated on every use, using a rotated token again means it was stolen,
+// so the whole session is revoked, including its latest access token.
+type SessionManager struct {
+	jwt *Service
+	db  *gorm.DB
+	cfg SessionConfig
+}
+
+// NewSessionManager creates new session manager with the default config
+func NewSessionManager(j *Service, db *gorm.DB) *SessionManager {
+	cfg := DefaultSessionConfig
+	cfg.DB = db
+	return NewSessionManagerWithConfig(j, cfg)
+}
+
+// NewSessionManagerWithConfig creates new session manager with config.
+// The JWT service checks the revoked access tokens in the database unless it has a denylist already.
+func NewSessionManagerWithConfig(j *Service, cfg SessionConfig) *SessionManager {
+	if cfg.RefreshTTL <= 0 {
+		cfg.RefreshTTL = DefaultSessionConfig.RefreshTTL
+	}
+	if j.denylist == nil {
+		j.denylist = NewPostgresDenylist(cfg.DB)
+	}
+	return &SessionManager{jwt: j, db: cfg.DB, cfg: cfg}
+}
+
+// Login starts new session of the subject on the device, returning the first token pair
+func (m *SessionManager) Login(ctx context.Context, subject string, claims map[string]interface{}, device Device) (*TokenPair, error) {
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	var pair *TokenPair
+	err = m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		sess := &Session{
+			Subject:    subject,
+			DeviceID:   device.ID,
+			DeviceName: device.Name,
+			UserAgent:  device.UserAgent,
+			IP:         device.IP,
+			Claims:     string(claimsJSON),
+			LastUsedAt: now,
+			ExpiresAt:  now.Add(m.cfg.RefreshTTL),
+		}
+		if err := dbcore.NewDB(&Session{}).Create(tx, sess); err != nil {
+			return err
+		}
+		pair, err = m.issue(tx, sess, claims)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// Refresh rotates the refresh token, returning new token pair of the session.
+// ErrRefreshTokenReused is returned when the token was rotated already, the session is revoked then.
+func (m *SessionManager) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	var pair *TokenPair
+	var reused *Session
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		rt := new(RefreshToken)
+		if err := dbcore.NewDB(&RefreshToken{}).View(tx, rt, "token_hash = ?", hashToken(refreshToken)); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+		sess := new(Session)
+		if err := dbcore.NewDB(&Session{}).View(tx, sess, "id = ?", rt.SessionID); err != nil {
+			return err
+		}
+		if sess.RevokedAt != nil || now.After(sess.ExpiresAt) || now.After(rt.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+
+		// the token is marked as used only once, concurrent refreshes with the same token are reuses
+		res := tx.Model(&RefreshToken{}).Where("id = ? AND used_at IS NULL", rt.ID).Update("used_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			reused = sess
+			return nil
+		}
+
+		claims, err := m.claims(ctx, sess)
+		if err != nil {
+			return err
+		}
+		pair, err = m.issue(tx, sess, claims)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reused != nil {
+		logger.LogError(ctx, fmt.Sprintf("refresh token reused, revoking session %d of %s", reused.ID, reused.Subject))
+		if err := m.revoke(ctx, "id = ?", reused.ID); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+	return pair, nil
+}
+
+// Logout revokes the session of the refresh token, unknown tokens are ignored
+func (m *SessionManager) Logout(ctx context.Context, refreshToken string) error {
+	rt := new(RefreshToken)
+	if err := dbcore.NewDB(&RefreshToken{}).View(m.db.WithContext(ctx), rt, "token_hash = ?", hashToken(refreshToken)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	return m.revoke(ctx, "id = ?", rt.SessionID)
+}
+
+// LogoutAll revokes all sessions of the subject, e.g. after changing the password
+func (m *SessionManager) LogoutAll(ctx context.Context, subject string) error {
+	return m.revoke(ctx, "subject = ?", subject)
+}
+
+// RevokeSession revokes a session of the subject, e.g. logging out a lost device
+func (m *SessionManager) RevokeSession(ctx context.Context, subject string, sessionID int) error {
+	return m.revoke(ctx, "id = ? AND subject = ?", sessionID, subject)
+}
+
+// Sessions lists the active sessions of the subject, most recently used first
+func (m *SessionManager) Sessions(ctx context.Context, subject string) ([]*Session, error) {
+	sessions := []*Session{}
+	db := m.db.WithContext(ctx).Where("subject = ? AND revoked_at IS NULL AND expires_at > ?", subject, time.Now())
+	lq := &dbcore.ListQueryCondition{Sort: []string{"last_used_at DESC"}}
+	if err := dbcore.NewDB(&Session{}).List(db, &sessions, lq, nil); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// DeleteExpired deletes the expired sessions, refresh tokens and revoked access tokens, e.g. in a scheduled job
+func (m *SessionManager) DeleteExpired(ctx context.Context) error {
+	db := m.db.WithContext(ctx)
+	now := time.Now()
+	if err := dbcore.NewDB(&RefreshToken{}).Delete(db, "expires_at < ?", now); err != nil {
+		return err
+	}
+	if err := dbcore.NewDB(&Session{}).Delete(db, "expires_at < ?", now); err != nil {
+		return err
+	}
+	return dbcore.NewDB(&RevokedToken{}).Delete(db, "expires_at < ?", now)
+}
+
+// issue generates the access token and a new refresh token of the session
+func (m *SessionManager) issue(tx *gorm.DB, sess *Session, claims map[string]interface{}) (*TokenPair, error) {
+	accessClaims := make(map[string]interface{}, len(claims)+3)
+	for k, v := range claims {
+		accessClaims[k] = v
+	}
+	jti := logadapter.NewID()
+	accessClaims["jti"] = jti
+	accessToken, expiresIn, err := m.jwt.GenerateToken(accessClaims, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	rt := &RefreshToken{
+		SessionID: sess.ID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: now.Add(m.cfg.RefreshTTL),
+	}
+	if err := dbcore.NewDB(&RefreshToken{}).Create(tx, rt); err != nil {
+		return nil, err
+	}
+	if err := dbcore.NewDB(&Session{}).Update(tx, map[string]interface{}{
+		"access_jti":        jti,
+		"access_expires_at": now.Add(time.Duration(expiresIn) * time.Second),
+		"last_used_at":      now,
+		"expires_at":        rt.ExpiresAt,
+	}, "id = ?", sess.ID); err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:      accessToken,
+		ExpiresIn:        expiresIn,
+		RefreshToken:     refreshToken,
+		RefreshExpiresIn: int(m.cfg.RefreshTTL.Seconds()),
+	}, nil
+}
+
+// claims returns the claims of the access tokens of the session
+func (m *SessionManager) claims(ctx context.Context, sess *Session) (map[string]interface{}, error) {
+	if m.cfg.ClaimsFunc != nil {
+		return m.cfg.ClaimsFunc(ctx, sess.Subject)
+	}
+	claims := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(sess.Claims), &claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// revoke revokes the active sessions matching the conditions and denies their latest access tokens.
+// The tokens are denied in the same transaction with the Postgres denylist of the session database,
+// otherwise after the sessions are revoked.
+func (m *SessionManager) revoke(ctx context.Context, cond ...interface{}) error {
+	pg, inTx := m.jwt.denylist.(*PostgresDenylist)
+	inTx = inTx && pg.db == m.db
+	pending := []*Session{}
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		sessions := []*Session{}
+		db := tx.Where("revoked_at IS NULL").Where(cond[0], cond[1:]...)
+		if err := dbcore.NewDB(&Session{}).List(db, &sessions, nil, nil); err != nil {
+			return err
+		}
+		if len(sessions) == 0 {
+			return nil
+		}
+
+		now := time.Now()
+		ids := make([]int, len(sessions))
+		for i, sess := range sessions {
+			ids[i] = sess.ID
+			if sess.AccessJTI == "" || !sess.AccessExpiresAt.After(now) {
+				continue
+			}
+			if !inTx {
+				pending = append(pending, sess)
+				continue
+			}
+			if err := revokeToken(tx, sess.AccessJTI, sess.AccessExpiresAt); err != nil {
+				return err
+			}
+		}
+		return dbcore.NewDB(&Session{}).Update(tx, map[string]interface{}{"revoked_at": now}, "id IN (?)", ids)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, sess := range pending {
+		if err := m.jwt.denylist.Revoke(ctx, sess.AccessJTI, sess.AccessExpiresAt); err != nil {
+			return fmt.Errorf("session %d revoked but failed to deny its access token: %w", sess.ID, err)
+		}
+	}
+	return nil
+}
+
+// newRefreshToken generates an opaque refresh token
+func newRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken hashes the refresh token, so stolen database rows cannot be used
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
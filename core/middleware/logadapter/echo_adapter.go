@@ -14,6 +14,7 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/gommon/log"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // EchoLogger extend logrus.Logger
@@ -367,6 +368,7 @@ func LogWithEchoContext(c echo.Context, content ...interface{}) {
 	logField := logrus.Fields{
 		"type": logType,
 	}
+	addContextFields(logField, c.Request().Context())
 
 	if len(content) > 2 {
 		if maps, ok := content[2].(map[string]interface{}); ok {
@@ -464,6 +466,7 @@ func LogWithContext(ctx context.Context, content ...interface{}) {
 	logField := logrus.Fields{
 		"type": logType,
 	}
+	addContextFields(logField, ctx)
 
 	if len(content) > 2 {
 		if maps, ok := content[2].(map[string]interface{}); ok {
@@ -489,3 +492,20 @@ func LogWithContext(ctx context.Context, content ...interface{}) {
 		l.Logger.WithFields(logField).Debug(content[0])
 	}
 }
+
+// addContextFields adds the request ID, correlation ID and trace ID of the context to the log fields
+func addContextFields(fields logrus.Fields, ctx context.Context) {
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		fields["request_id"] = requestID
+	}
+	if correlationID := CorrelationIDFromContext(ctx); correlationID != "" {
+		fields["correlation_id"] = correlationID
+	}
+	if ctx == nil {
+		return
+	}
+	if spanCtx := trace.SpanContextFromContext(ctx); spanCtx.IsValid() {
+		fields["trace_id"] = spanCtx.TraceID().String()
+		fields["span_id"] = spanCtx.SpanID().String()
+	}
+}
@@ -8,12 +8,21 @@ import (
 	"strings"
 	"time"
 
+	"github.com/namhoai1109/tabi/core/metrics"
+	"github.com/namhoai1109/tabi/core/tracing"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
 	gormlogger "gorm.io/gorm/logger"
 	"gorm.io/gorm/utils"
 )
 
+// rowsAffectedKey is the span attribute of the rows affected by the query
+const rowsAffectedKey = attribute.Key("db.rows_affected")
+
 // GormLogger model
 type GormLogger struct {
 	*Logger
@@ -78,7 +87,15 @@ func (l *GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (stri
 	if l.SourceField != "" {
 		fields[l.SourceField] = utils.FileWithLineNum()
 	}
+	var queryErr error
 	if err != nil && !(errors.Is(err, gorm.ErrRecordNotFound) && l.SkipErrRecordNotFound) {
+		queryErr = err
+	}
+	operation := sqlOperation(sql)
+	l.traceSpan(ctx, begin, sql, operation, row, queryErr)
+	metrics.ObserveDBQuery(operation, elapsed, queryErr)
+
+	if queryErr != nil {
 		fields[logrus.ErrorKey] = err
 		l.Logger.WithContext(ctx).WithFields(fields).Error()
 		return
@@ -95,6 +112,37 @@ func (l *GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (stri
 	}
 }
 
+// traceSpan records the query as a span starting at the begin time of the query
+func (l *GormLogger) traceSpan(ctx context.Context, begin time.Time, sql, operation string, row int64, err error) {
+	if ctx == nil || !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+		return
+	}
+	_, span := tracing.Start(ctx, operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(begin),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBOperation(operation)),
+	)
+	if l.Debug {
+		span.SetAttributes(semconv.DBStatement(sqlMask(sql)))
+	}
+	if row >= 0 {
+		span.SetAttributes(rowsAffectedKey.Int64(row))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// sqlOperation returns the statement keyword of the query, e.g. SELECT
+func sqlOperation(sql string) string {
+	if words := strings.Fields(sql); len(words) > 0 {
+		return strings.ToUpper(words[0])
+	}
+	return "SQL"
+}
+
 func sqlMask(sql string) string {
 	if len(sql) < DefaultLargeFieldLength {
 		return sql
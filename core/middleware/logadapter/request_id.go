@@ -0,0 +1,88 @@
+package logadapter
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+
+	"github.com/labstack/echo/v4"
+)
+
+// NewRequestIDMiddleware returns a middleware which accepts the request ID and correlation ID headers
+// or generates them, then stores them in the request context and the response headers.
+// The correlation ID defaults to the request ID when the request is the first of the flow.
+func NewRequestIDMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			requestID := req.Header.Get(string(RequestIDKey))
+			if requestID == "" {
+				requestID = NewID()
+				req.Header.Set(string(RequestIDKey), requestID)
+			}
+			correlationID := req.Header.Get(string(CorrelationIDKey))
+			if correlationID == "" {
+				correlationID = requestID
+				req.Header.Set(string(CorrelationIDKey), correlationID)
+			}
+
+			ctx := WithRequestID(req.Context(), requestID)
+			ctx = WithCorrelationID(ctx, correlationID)
+			c.SetRequest(req.WithContext(ctx))
+			c.Response().Header().Set(string(RequestIDKey), requestID)
+			c.Response().Header().Set(string(CorrelationIDKey), correlationID)
+			return next(c)
+		}
+	}
+}
+
+// WithRequestID returns a copy of the context holding the request ID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, RequestIDKey, requestID)
+}
+
+// WithCorrelationID returns a copy of the context holding the correlation ID
+func WithCorrelationID(ctx context.Context, correlationID string) context.Context {
+	return context.WithValue(ctx, CorrelationIDKey, correlationID)
+}
+
+// RequestIDFromContext returns the request ID of the context, or empty string if not found
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	requestID, _ := ctx.Value(RequestIDKey).(string)
+	return requestID
+}
+
+// CorrelationIDFromContext returns the correlation ID of the context, or empty string if not found
+func CorrelationIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	correlationID, _ := ctx.Value(CorrelationIDKey).(string)
+	return correlationID
+}
+
+// PropagationHeaders returns the request ID and correlation ID headers of the context to forward to other services
+func PropagationHeaders(ctx context.Context) map[string]string {
+	headers := make(map[string]string, 2)
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		headers[string(RequestIDKey)] = requestID
+	}
+	if correlationID := CorrelationIDFromContext(ctx); correlationID != "" {
+		headers[string(CorrelationIDKey)] = correlationID
+	}
+	return headers
+}
+
+// NewID generates a random UUID (version 4)
+func NewID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -30,3 +30,31 @@ func getCaller() string {
 
 	return ""
 }
+
+// StackFrame represents a parsed frame of the call stack
+type StackFrame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+// GetStack returns at most size frames of the call stack of the caller, skipping the given number of frames
+func GetStack(skip, size int) []StackFrame {
+	pcs := make([]uintptr, size)
+	n := runtime.Callers(skip+2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	stack := make([]StackFrame, 0, n)
+	for {
+		frame, more := frames.Next()
+		stack = append(stack, StackFrame{
+			Function: frame.Function,
+			File:     frame.File,
+			Line:     frame.Line,
+		})
+		if !more {
+			break
+		}
+	}
+	return stack
+}
@@ -0,0 +1,278 @@
+package secure
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/namhoai1109/tabi/core/logger"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// RateLimitState holds the state of a rate limit key, interpreted by the strategy
+type RateLimitState struct {
+	// Value is the remaining tokens (token bucket) or the requests of the current window (sliding window)
+	Value float64
+	// Prev is the requests of the previous window (sliding window)
+	Prev float64
+	// At is the last refill time (token bucket) or the start of the current window (sliding window)
+	At time.Time
+}
+
+// RateLimitStrategy decides whether a request is allowed by the state of its key
+type RateLimitStrategy interface {
+	// Take consumes one request from the state, returning whether it is allowed
+	// and how long to wait before retrying when it is not
+	Take(state *RateLimitState, now time.Time) (bool, time.Duration)
+	// TTL is the duration after which an idle state can be discarded
+	TTL() time.Duration
+}
+
+// RateLimitStore loads and saves the states of rate limit keys
+type RateLimitStore interface {
+	// Update loads the state of the key, applies fn and saves it atomically.
+	// The state is reset when it was not updated within ttl.
+	Update(ctx context.Context, key string, ttl time.Duration, fn func(state *RateLimitState) error) error
+}
+
+// TokenBucket allows bursts of limit requests, refilling limit tokens per period
+type TokenBucket struct {
+	Limit  int
+	Period time.Duration
+}
+
+// Take implements RateLimitStrategy
+func (b TokenBucket) Take(state *RateLimitState, now time.Time) (bool, time.Duration) {
+	capacity := float64(b.Limit)
+	rate := capacity / b.Period.Seconds()
+
+	tokens := capacity
+	if !state.At.IsZero() {
+		tokens = math.Min(capacity, state.Value+now.Sub(state.At).Seconds()*rate)
+	}
+	state.At = now
+
+	if tokens < 1 {
+		state.Value = tokens
+		return false, time.Duration((1 - tokens) / rate * float64(time.Second))
+	}
+	state.Value = tokens - 1
+	return true, 0
+}
+
+// Validate checks the limit and the period are positive
+func (b TokenBucket) Validate() error {
+	if b.Limit <= 0 || b.Period <= 0 {
+		return fmt.Errorf("invalid token bucket %d per %s, limit and period must be positive", b.Limit, b.Period)
+	}
+	return nil
+}
+
+// TTL implements RateLimitStrategy, the bucket is full again after a period
+func (b TokenBucket) TTL() time.Duration {
+	return b.Period
+}
+
+// SlidingWindow allows limit requests within any window, weighting the requests of the previous window
+type SlidingWindow struct {
+	Limit  int
+	Window time.Duration
+}
+
+// Take implements RateLimitStrategy
+func (w SlidingWindow) Take(state *RateLimitState, now time.Time) (bool, time.Duration) {
+	switch {
+	case state.At.IsZero() || now.Sub(state.At) >= 2*w.Window:
+		state.Value, state.Prev, state.At = 0, 0, now.Truncate(w.Window)
+	case now.Sub(state.At) >= w.Window:
+		state.Prev, state.Value, state.At = state.Value, 0, state.At.Add(w.Window)
+	}
+
+	limit := float64(w.Limit)
+	elapsed := now.Sub(state.At)
+	weight := 1 - float64(elapsed)/float64(w.Window)
+	if state.Prev*weight+state.Value+1 <= limit {
+		state.Value++
+		return true, 0
+	}
+
+	// the current window alone exceeds the limit, wait for the next window
+	if state.Value+1 > limit || state.Prev == 0 {
+		return false, w.Window - elapsed
+	}
+	// wait until the weight of the previous window drops enough
+	allowedWeight := (limit - state.Value - 1) / state.Prev
+	return false, time.Duration((1-allowedWeight)*float64(w.Window)) - elapsed
+}
+
+// Validate checks the limit and the window are positive
+func (w SlidingWindow) Validate() error {
+	if w.Limit <= 0 || w.Window <= 0 {
+		return fmt.Errorf("invalid sliding window %d per %s, limit and window must be positive", w.Limit, w.Window)
+	}
+	return nil
+}
+
+// TTL implements RateLimitStrategy, the previous window is not weighted after two windows
+func (w SlidingWindow) TTL() time.Duration {
+	return 2 * w.Window
+}
+
+// RateLimiter limits requests by key, e.g. for OTP sending or verifying outside of HTTP middlewares
+type RateLimiter struct {
+	store    RateLimitStore
+	strategy RateLimitStrategy
+}
+
+// NewRateLimiter creates new rate limiter, it panics when the strategy is invalid
+func NewRateLimiter(store RateLimitStore, strategy RateLimitStrategy) *RateLimiter {
+	mustValidStrategy(strategy)
+	return &RateLimiter{store: store, strategy: strategy}
+}
+
+// Allow consumes one request of the key, returning whether it is allowed
+// and how long to wait before retrying when it is not
+func (r *RateLimiter) Allow(ctx context.Context, key string) (bool, time.Duration, error) {
+	var allowed bool
+	var retryAfter time.Duration
+	err := r.store.Update(ctx, key, r.strategy.TTL(), func(state *RateLimitState) error {
+		allowed, retryAfter = r.strategy.Take(state, time.Now())
+		return nil
+	})
+	if err != nil {
+		return false, 0, err
+	}
+	return allowed, retryAfter, nil
+}
+
+// mustValidStrategy panics when the strategy has a Validate method returning an error
+func mustValidStrategy(strategy RateLimitStrategy) {
+	if v, ok := strategy.(interface{ Validate() error }); ok {
+		if err := v.Validate(); err != nil {
+			panic(err.Error())
+		}
+	}
+}
+
+// RateLimitKeyFunc returns the key of the request to be limited
+type RateLimitKeyFunc func(c echo.Context) (string, error)
+
+// KeyByIP limits requests by the client IP
+func KeyByIP() RateLimitKeyFunc {
+	return func(c echo.Context) (string, error) {
+		return "ip:" + c.RealIP(), nil
+	}
+}
+
+// KeyByClaim limits requests by the JWT claim, e.g. the user ID, falling back to the client IP
+// when the claim is not found. The JWT middleware must be executed before.
+func KeyByClaim(claim string) RateLimitKeyFunc {
+	return func(c echo.Context) (string, error) {
+		if val := c.Get(claim); val != nil {
+			return fmt.Sprintf("%s:%v", claim, val), nil
+		}
+		return KeyByIP()(c)
+	}
+}
+
+// KeyByHeader limits requests by the header value, e.g. an API key, falling back to the client IP
+// when the header is not found. The value is hashed, so it is not kept in the store.
+func KeyByHeader(header string) RateLimitKeyFunc {
+	return func(c echo.Context) (string, error) {
+		val := c.Request().Header.Get(header)
+		if val == "" {
+			return KeyByIP()(c)
+		}
+		sum := sha256.Sum256([]byte(val))
+		return header + ":" + hex.EncodeToString(sum[:]), nil
+	}
+}
+
+// RateLimitConfig represents rate limit middleware specific config
+type RateLimitConfig struct {
+	Skipper middleware.Skipper
+	// Name prefixes the keys, so the limits of different routes are independent, e.g. "login"
+	Name string
+	// Strategy is the rate limit strategy, default is TokenBucket of 60 requests per minute
+	Strategy RateLimitStrategy
+	// Store keeps the states, default is the in-memory store.
+	// Use the Postgres store to share the limits across Lambda instances.
+	Store RateLimitStore
+	// KeyFunc returns the key of the request, default is KeyByIP
+	KeyFunc RateLimitKeyFunc
+	// DenyOnError denies the requests when the store fails, otherwise they are allowed
+	DenyOnError bool
+}
+
+// DefaultRateLimitConfig is the default rate limit middleware config
+var DefaultRateLimitConfig = RateLimitConfig{
+	Skipper:  middleware.DefaultSkipper,
+	Strategy: TokenBucket{Limit: 60, Period: time.Minute},
+	KeyFunc:  KeyByIP(),
+}
+
+// RateLimit limits the requests by client IP to limit per period using the in-memory store
+func RateLimit(limit int, period time.Duration) echo.MiddlewareFunc {
+	c := DefaultRateLimitConfig
+	c.Strategy = TokenBucket{Limit: limit, Period: period}
+	return RateLimitWithConfig(c)
+}
+
+// RateLimitWithConfig limits the requests by key, responding 429 with Retry-After header when exceeded
+func RateLimitWithConfig(config RateLimitConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = DefaultRateLimitConfig.Skipper
+	}
+	if config.Strategy == nil {
+		config.Strategy = DefaultRateLimitConfig.Strategy
+	}
+	if config.Store == nil {
+		config.Store = NewMemoryRateLimitStore()
+	}
+	if config.KeyFunc == nil {
+		config.KeyFunc = DefaultRateLimitConfig.KeyFunc
+	}
+	limiter := NewRateLimiter(config.Store, config.Strategy)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			key, err := config.KeyFunc(c)
+			if err != nil {
+				return err
+			}
+			if config.Name != "" {
+				key = config.Name + ":" + key
+			}
+
+			ctx := c.Request().Context()
+			allowed, retryAfter, err := limiter.Allow(ctx, key)
+			if err != nil {
+				logger.LogError(ctx, fmt.Sprintf("failed to check rate limit of %s with err: %v", key, err))
+				if config.DenyOnError {
+					return echo.NewHTTPError(http.StatusServiceUnavailable, "Service is temporarily unavailable, please try again later.")
+				}
+				return next(c)
+			}
+			if !allowed {
+				seconds := int(math.Ceil(retryAfter.Seconds()))
+				if seconds < 1 {
+					seconds = 1
+				}
+				c.Response().Header().Set("Retry-After", strconv.Itoa(seconds))
+				return echo.NewHTTPError(http.StatusTooManyRequests, "Too many requests, please try again later.")
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package secure
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultRateLimitTable is the default table of the Postgres rate limit store
+const DefaultRateLimitTable = "rate_limits"
+
+// sweepInterval is the interval of discarding the expired states of the in-memory store
+const sweepInterval = time.Minute
+
+type memoryRateLimitEntry struct {
+	state     RateLimitState
+	expiresAt time.Time
+}
+
+// MemoryRateLimitStore keeps the states in memory, the limits are per instance
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryRateLimitEntry
+	lastSweep time.Time
+}
+
+// NewMemoryRateLimitStore creates new in-memory rate limit store
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		entries:   make(map[string]*memoryRateLimitEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+// Update implements RateLimitStore
+func (s *MemoryRateLimitStore) Update(ctx context.Context, key string, ttl time.Duration, fn func(state *RateLimitState) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		for k, e := range s.entries {
+			if now.After(e.expiresAt) {
+				delete(s.entries, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	state := RateLimitState{}
+	if e, ok := s.entries[key]; ok && !now.After(e.expiresAt) {
+		state = e.state
+	}
+	if err := fn(&state); err != nil {
+		return err
+	}
+	s.entries[key] = &memoryRateLimitEntry{state: state, expiresAt: now.Add(ttl)}
+	return nil
+}
+
+// RateLimitRecord represents the state of a rate limit key in the Postgres store,
+// it can be used to migrate the table, e.g. db.Table(secure.DefaultRateLimitTable).AutoMigrate(&secure.RateLimitRecord{})
+type RateLimitRecord struct {
+	Key       string    `gorm:"column:key;primaryKey"`
+	Value     float64   `gorm:"column:value;not null;default:0"`
+	Prev      float64   `gorm:"column:prev;not null;default:0"`
+	At        time.Time `gorm:"column:at"`
+	ExpiresAt time.Time `gorm:"column:expires_at;index"`
+}
+
+// PostgresRateLimitStore keeps the states in Postgres, so the limits are shared across instances.
+// Concurrent updates of a key are serialized by row locks.
+type PostgresRateLimitStore struct {
+	db    *gorm.DB
+	table string
+}
+
+// NewPostgresRateLimitStore creates new Postgres rate limit store using the DefaultRateLimitTable
+func NewPostgresRateLimitStore(db *gorm.DB) *PostgresRateLimitStore {
+	return NewPostgresRateLimitStoreWithTable(db, DefaultRateLimitTable)
+}
+
+// NewPostgresRateLimitStoreWithTable creates new Postgres rate limit store using the given table
+func NewPostgresRateLimitStoreWithTable(db *gorm.DB, table string) *PostgresRateLimitStore {
+	return &PostgresRateLimitStore{db: db, table: table}
+}
+
+// Update implements RateLimitStore
+func (s *PostgresRateLimitStore) Update(ctx context.Context, key string, ttl time.Duration, fn func(state *RateLimitState) error) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// make sure the row exists, so it can be locked
+		if err := tx.Table(s.table).Clauses(clause.OnConflict{DoNothing: true}).Create(&RateLimitRecord{Key: key}).Error; err != nil {
+			return err
+		}
+		rec := new(RateLimitRecord)
+		if err := tx.Table(s.table).Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ?", key).Take(rec).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		state := RateLimitState{}
+		if now.Before(rec.ExpiresAt) {
+			state = RateLimitState{Value: rec.Value, Prev: rec.Prev, At: rec.At}
+		}
+		if err := fn(&state); err != nil {
+			return err
+		}
+		return tx.Table(s.table).Where("key = ?", key).Updates(map[string]interface{}{
+			"value":      state.Value,
+			"prev":       state.Prev,
+			"at":         state.At,
+			"expires_at": now.Add(ttl),
+		}).Error
+	})
+}
+
+// DeleteExpired deletes the expired states, e.g. in a scheduled job
+func (s *PostgresRateLimitStore) DeleteExpired(ctx context.Context) error {
+	return s.db.WithContext(ctx).Table(s.table).Where("expires_at < ?", time.Now()).Delete(&RateLimitRecord{}).Error
+}
@@ -37,12 +37,18 @@ func CORS(cfg *Config) echo.MiddlewareFunc {
 	}
 
 	return middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins:     allowOrigins,
-		AllowMethods:     []string{"POST", "GET", "PUT", "DELETE", "PATCH", "HEAD"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
+		AllowOrigins: allowOrigins,
+		AllowMethods: []string{"POST", "GET", "PUT", "DELETE", "PATCH", "HEAD"},
+		AllowHeaders: []string{
+			"Origin", "Content-Type", "Accept", "Authorization", "Idempotency-Key", "If-Match", "If-None-Match", "X-CSRF-Token",
+			HeaderSignatureKeyID, HeaderSignatureTimestamp, HeaderSignatureNonce, HeaderSignature,
+			string(logadapter.RequestIDKey), string(logadapter.CorrelationIDKey),
+		},
 		AllowCredentials: true,
-		ExposeHeaders:    []string{"Content-Length"},
-		MaxAge:           86400,
+		ExposeHeaders: []string{
+			"Content-Length", "Link", "ETag", "X-Total-Count", "Retry-After", string(logadapter.RequestIDKey),
+		},
+		MaxAge: 86400,
 	})
 }
 
@@ -0,0 +1,227 @@
+package secure
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/namhoai1109/tabi/core/logger"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// Signature headers
+const (
+	HeaderSignatureKeyID     = "X-Signature-Key-Id"
+	HeaderSignatureTimestamp = "X-Signature-Timestamp"
+	HeaderSignatureNonce     = "X-Signature-Nonce"
+	HeaderSignature          = "X-Signature"
+)
+
+// SignatureKeyIDKey is the key of the verified key ID in the echo context
+const SignatureKeyIDKey = "signature_key_id"
+
+// DefaultSignatureWindow is the default max clock difference between the signer and the verifier,
+// the nonces are kept for the window so the requests cannot be replayed
+const DefaultSignatureWindow = 5 * time.Minute
+
+// errNonceUsed is returned by the nonce store when the nonce was used within the window
+var errNonceUsed = errors.New("nonce used")
+
+// StringToSign returns the canonical request signed with HMAC-SHA256:
+// method, path with query, timestamp, nonce and the hex SHA-256 of the body, separated by new lines
+func StringToSign(method, path, timestamp, nonce string, body []byte) string {
+	sum := sha256.Sum256(body)
+	return method + "\n" + path + "\n" + timestamp + "\n" + nonce + "\n" + hex.EncodeToString(sum[:])
+}
+
+// Sign returns the hex HMAC-SHA256 of the string to sign
+func Sign(secret, stringToSign string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(stringToSign))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Signer signs the outgoing requests, e.g. the s2s requests to the services verifying signatures
+type Signer struct {
+	keyID  string
+	secret string
+}
+
+// NewSigner creates new request signer with the key ID and its secret
+func NewSigner(keyID, secret string) *Signer {
+	return &Signer{keyID: keyID, secret: secret}
+}
+
+// Sign sets the signature headers of the request, the body is read and restored
+func (s *Signer) Sign(req *http.Request) error {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	nonce := hex.EncodeToString(b)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(HeaderSignatureKeyID, s.keyID)
+	req.Header.Set(HeaderSignatureTimestamp, timestamp)
+	req.Header.Set(HeaderSignatureNonce, nonce)
+	req.Header.Set(HeaderSignature, Sign(s.secret, StringToSign(req.Method, requestPath(req), timestamp, nonce, body)))
+	return nil
+}
+
+// requestPath returns the escaped path with the query of the request
+func requestPath(req *http.Request) string {
+	if req.URL.RawQuery == "" {
+		return req.URL.EscapedPath()
+	}
+	return req.URL.EscapedPath() + "?" + req.URL.RawQuery
+}
+
+// NonceStore remembers the nonces of the signed requests within the window
+type NonceStore interface {
+	// Use marks the nonce as used for ttl, returning false when it was used already
+	Use(ctx context.Context, nonce string, ttl time.Duration) (bool, error)
+}
+
+// rateLimitNonceStore keeps the nonces in a rate limit store
+type rateLimitNonceStore struct {
+	store RateLimitStore
+}
+
+// NewNonceStore creates new nonce store on top of the rate limit store, e.g. the Postgres one
+// to share the nonces across instances: secure.NewNonceStore(secure.NewPostgresRateLimitStoreWithTable(db, "request_nonces"))
+func NewNonceStore(store RateLimitStore) NonceStore {
+	return &rateLimitNonceStore{store: store}
+}
+
+// Use implements NonceStore
+func (s *rateLimitNonceStore) Use(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	err := s.store.Update(ctx, "nonce:"+nonce, ttl, func(state *RateLimitState) error {
+		if !state.At.IsZero() {
+			return errNonceUsed
+		}
+		state.At = time.Now()
+		return nil
+	})
+	if errors.Is(err, errNonceUsed) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// SignatureConfig represents signature middleware specific config
+type SignatureConfig struct {
+	Skipper middleware.Skipper
+	// SecretFunc returns the secret of the key ID, e.g. from the secret provider. Required
+	SecretFunc func(ctx context.Context, keyID string) (string, error)
+	// Window is the max age of the signed requests, default is DefaultSignatureWindow
+	Window time.Duration
+	// Nonces remembers the nonces within the window, default is the in-memory store
+	Nonces NonceStore
+}
+
+// Signature verifies the HMAC signature of the requests signed with the secrets of the map, by key ID
+func Signature(secrets map[string]string) echo.MiddlewareFunc {
+	return SignatureWithConfig(SignatureConfig{
+		SecretFunc: func(ctx context.Context, keyID string) (string, error) {
+			secret, ok := secrets[keyID]
+			if !ok {
+				return "", fmt.Errorf("unknown key %s", keyID)
+			}
+			return secret, nil
+		},
+	})
+}
+
+// SignatureWithConfig verifies the HMAC signature of the requests, e.g. inbound webhooks of the partners.
+// The requests older than the window or replayed with the same nonce are rejected with 401.
+func SignatureWithConfig(config SignatureConfig) echo.MiddlewareFunc {
+	if config.SecretFunc == nil {
+		panic("signature middleware requires SecretFunc")
+	}
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if config.Window <= 0 {
+		config.Window = DefaultSignatureWindow
+	}
+	if config.Nonces == nil {
+		config.Nonces = NewNonceStore(NewMemoryRateLimitStore())
+	}
+	unauthorized := func() error {
+		return echo.NewHTTPError(http.StatusUnauthorized, "The request signature is invalid.")
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+			req := c.Request()
+			ctx := req.Context()
+			keyID := req.Header.Get(HeaderSignatureKeyID)
+			timestamp := req.Header.Get(HeaderSignatureTimestamp)
+			nonce := req.Header.Get(HeaderSignatureNonce)
+			signature := req.Header.Get(HeaderSignature)
+			if keyID == "" || timestamp == "" || nonce == "" || signature == "" {
+				return unauthorized()
+			}
+
+			ts, err := strconv.ParseInt(timestamp, 10, 64)
+			if err != nil {
+				return unauthorized()
+			}
+			if age := time.Since(time.Unix(ts, 0)); age > config.Window || age < -config.Window {
+				return unauthorized()
+			}
+
+			secret, err := config.SecretFunc(ctx, keyID)
+			if err != nil {
+				logger.LogError(ctx, fmt.Sprintf("failed to get signature secret of %s with err: %v", keyID, err))
+				return unauthorized()
+			}
+			var body []byte
+			if req.Body != nil {
+				if body, err = io.ReadAll(req.Body); err != nil {
+					return err
+				}
+				req.Body = io.NopCloser(bytes.NewReader(body))
+			}
+			expected := Sign(secret, StringToSign(req.Method, requestPath(req), timestamp, nonce, body))
+			if !hmac.Equal([]byte(signature), []byte(expected)) {
+				return unauthorized()
+			}
+
+			// the nonce is kept for both sides of the window as the clocks may differ
+			ok, err := config.Nonces.Use(ctx, keyID+":"+nonce, 2*config.Window)
+			if err != nil {
+				logger.LogError(ctx, fmt.Sprintf("failed to check signature nonce with err: %v", err))
+				return echo.NewHTTPError(http.StatusServiceUnavailable, "Service is temporarily unavailable, please try again later.")
+			}
+			if !ok {
+				return unauthorized()
+			}
+
+			c.Set(SignatureKeyIDKey, keyID)
+			return next(c)
+		}
+	}
+}
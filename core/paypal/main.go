@@ -10,7 +10,10 @@ import (
 	"github.com/go-resty/resty/v2"
 
 	"github.com/namhoai1109/tabi/core/logger"
+	"github.com/namhoai1109/tabi/core/metrics"
 	"github.com/namhoai1109/tabi/core/paypal/model"
+	"github.com/namhoai1109/tabi/core/secret"
+	"github.com/namhoai1109/tabi/core/tracing"
 	structutil "github.com/namhoai1109/tabi/util/struct"
 )
 
@@ -23,7 +26,7 @@ var (
 )
 
 func (s *Service) generatePaypalClient(ctx context.Context) (*resty.Client, error) {
-	client := resty.New()
+	client := metrics.InstrumentClient(tracing.InstrumentClient(resty.New()), "paypal")
 	client.SetDebug(s.cfg.Debug)
 	client.SetBaseURL(s.baseURL)
 	client.SetTimeout(time.Duration(s.cfg.Timeout) * time.Second)
@@ -36,18 +39,25 @@ func (s *Service) generatePaypalClient(ctx context.Context) (*resty.Client, erro
 		"return_unconsented_scopes": true,
 	}
 
-	logger.LogHTTPRequest(ctx, s.baseURL, GENERATE_ACCESS_TOKEN_PATH, resty.MethodPost, body)
-	resp, err := client.R().
-		SetContext(ctx).
-		SetBasicAuth(s.cfg.ClientID, s.cfg.ClientSecret).
-		SetHeader("Content-Type", "application/x-www-form-urlencoded").
-		SetFormData(s.convertToFormData(body)).
-		Post(GENERATE_ACCESS_TOKEN_PATH)
+	creds, err := s.credentials(ctx, false)
 	if err != nil {
-		logger.LogError(ctx, fmt.Sprintf("Error when request to generate access token: %v", err))
+		logger.LogError(ctx, fmt.Sprintf("Error when get paypal credentials: %v", err))
 		return nil, err
 	}
-	logger.LogHTTPResponse(ctx, s.baseURL, GENERATE_ACCESS_TOKEN_PATH, resp.Body(), resp.StatusCode(), resp.Time())
+	resp, err := s.requestAccessToken(ctx, client, creds, body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() == http.StatusUnauthorized && s.cfg.SecretID != "" {
+		// the credentials may have been rotated since they were cached
+		if creds, err = s.credentials(ctx, true); err != nil {
+			logger.LogError(ctx, fmt.Sprintf("Error when refresh paypal credentials: %v", err))
+			return nil, err
+		}
+		if resp, err = s.requestAccessToken(ctx, client, creds, body); err != nil {
+			return nil, err
+		}
+	}
 
 	if errResp := s.BuildError(resp); errResp != nil {
 		return nil, errResp
@@ -63,6 +73,38 @@ func (s *Service) generatePaypalClient(ctx context.Context) (*resty.Client, erro
 	return client, nil
 }
 
+func (s *Service) requestAccessToken(ctx context.Context, client *resty.Client, creds *Config, body map[string]interface{}) (*resty.Response, error) {
+	logger.LogHTTPRequest(ctx, s.baseURL, GENERATE_ACCESS_TOKEN_PATH, resty.MethodPost, body)
+	resp, err := client.R().
+		SetContext(ctx).
+		SetBasicAuth(creds.ClientID, creds.ClientSecret).
+		SetHeader("Content-Type", "application/x-www-form-urlencoded").
+		SetFormData(s.convertToFormData(body)).
+		Post(GENERATE_ACCESS_TOKEN_PATH)
+	if err != nil {
+		logger.LogError(ctx, fmt.Sprintf("Error when request to generate access token: %v", err))
+		return nil, err
+	}
+	logger.LogHTTPResponse(ctx, s.baseURL, GENERATE_ACCESS_TOKEN_PATH, resp.Body(), resp.StatusCode(), resp.Time())
+	return resp, nil
+}
+
+// credentials returns the client ID and secret of the config or of the secret, refreshing the secret if requested
+func (s *Service) credentials(ctx context.Context, refresh bool) (*Config, error) {
+	if s.cfg.SecretID == "" {
+		return &s.cfg, nil
+	}
+	provider := s.cfg.SecretProvider
+	if provider == nil {
+		provider = secret.Default()
+	}
+	creds := new(Config)
+	if refresh {
+		return creds, secret.RefreshJSON(ctx, provider, s.cfg.SecretID, creds)
+	}
+	return creds, secret.GetJSON(ctx, provider, s.cfg.SecretID, creds)
+}
+
 func (s *Service) CreateOrder(ctx context.Context, creation *model.CreateOrderRequest) (*model.CreateOrderResponse, error) {
 	client, err := s.generatePaypalClient(ctx)
 	if err != nil {
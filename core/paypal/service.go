@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/namhoai1109/tabi/core/paypal/model"
+	"github.com/namhoai1109/tabi/core/secret"
 )
 
 type Config struct {
@@ -11,6 +12,10 @@ type Config struct {
 	ClientSecret string `json:"client_secret"`
 	Debug        bool
 	Timeout      int // in seconds
+	// SecretID is the secret holding the client_id and client_secret JSON, it takes precedence over ClientID and ClientSecret
+	SecretID string `json:"-"`
+	// SecretProvider provides the secret of SecretID, default is secret.Default()
+	SecretProvider secret.Provider `json:"-"`
 }
 
 func New(baseURL string, cfg Config) *Service {
@@ -6,6 +6,7 @@ import (
 
 	resty "github.com/go-resty/resty/v2"
 	"github.com/namhoai1109/tabi/core/middleware/jwt"
+	"github.com/namhoai1109/tabi/core/middleware/secure"
 )
 
 // Config represents the configuration
@@ -17,14 +18,20 @@ type Config struct {
 	Debug        bool
 	Timeout      int // in seconds
 	Region       string
+	// APIKey is sent in X-API-Key header instead of generating access tokens when not empty,
+	// the JWT config is optional then
+	APIKey string
+	// Signer signs the requests with HMAC when not nil, for the services verifying signatures
+	Signer *secure.Signer
 }
 
 // New creates new bnpl service
 func New(cfg Config) *Service {
-	return &Service{
-		jwt: jwt.New(cfg.JwtAlgorithm, cfg.JwtSecret, cfg.JwtDuration),
-		cfg: cfg,
+	s := &Service{cfg: cfg}
+	if cfg.APIKey == "" || cfg.JwtAlgorithm != "" {
+		s.jwt = jwt.New(cfg.JwtAlgorithm, cfg.JwtSecret, cfg.JwtDuration)
 	}
+	return s
 }
 
 // Service represents the bnpl service
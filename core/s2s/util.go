@@ -15,17 +15,48 @@ import (
 	resty "github.com/go-resty/resty/v2"
 	client "github.com/namhoai1109/tabi/core/http"
 	"github.com/namhoai1109/tabi/core/logger"
+	"github.com/namhoai1109/tabi/core/metrics"
+	"github.com/namhoai1109/tabi/core/middleware/apikey"
+	"github.com/namhoai1109/tabi/core/middleware/logadapter"
+	"github.com/namhoai1109/tabi/core/middleware/secure"
+	"github.com/namhoai1109/tabi/core/tracing"
 	structutil "github.com/namhoai1109/tabi/util/struct"
 	"github.com/thoas/go-funk"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// newClient creates traced and measured http client with the access token and the request ID, correlation ID headers of the context
+func (s *Service) newClient(ctx context.Context, url string, customAccessToken ...string) *client.Client[any] {
+	c := client.NewClient(s.jwt)
+	c.SetDebug(s.cfg.Debug)
+	c.SetBaseURL(url)
+	c.SetTimeout(time.Duration(s.cfg.Timeout) * time.Second)
+	if s.cfg.APIKey != "" && len(customAccessToken) == 0 {
+		c.SetHeaders(map[string]string{
+			"Accept":            "application/json",
+			"Content-Type":      "application/json",
+			apikey.HeaderAPIKey: s.cfg.APIKey,
+		})
+	} else {
+		c.GenerateAccessToken(time.Duration(s.cfg.Duration), customAccessToken...)
+	}
+	c.SetHeaders(logadapter.PropagationHeaders(ctx))
+	if s.cfg.Signer != nil {
+		// the hook runs on every attempt, so the retries are signed with fresh timestamp and nonce
+		c.SetPreRequestHook(func(_ *resty.Client, req *http.Request) error {
+			return s.cfg.Signer.Sign(req)
+		})
+	}
+	tracing.InstrumentClient(c.Client)
+	metrics.InstrumentClient(c.Client, "s2s")
+	return c
+}
+
 // Get wrapper of request of method GET
 func (s *Service) Get(ctx context.Context, url, path string, customAccessToken ...string) (*resty.Response, error) {
-	client := client.NewClient(s.jwt)
-	client.SetDebug(s.cfg.Debug)
-	client.SetBaseURL(url)
-	client.SetTimeout(time.Duration(s.cfg.Timeout) * time.Second)
-	client.GenerateAccessToken(time.Duration(s.cfg.Duration), customAccessToken...)
+	client := s.newClient(ctx, url, customAccessToken...)
 	logger.LogHTTPRequest(ctx, url, path, resty.MethodGet, nil)
 	resp, err := client.R().SetContext(ctx).Get(path)
 	if err != nil {
@@ -37,11 +68,7 @@ func (s *Service) Get(ctx context.Context, url, path string, customAccessToken .
 
 // Post wrapper of request of method POST
 func (s *Service) Post(ctx context.Context, params map[string]interface{}, url, path string, customAccessToken ...string) (*resty.Response, error) {
-	client := client.NewClient(s.jwt)
-	client.SetDebug(s.cfg.Debug)
-	client.SetBaseURL(url)
-	client.SetTimeout(time.Duration(s.cfg.Timeout) * time.Second)
-	client.GenerateAccessToken(time.Duration(s.cfg.Duration), customAccessToken...)
+	client := s.newClient(ctx, url, customAccessToken...)
 	logger.LogHTTPRequest(ctx, url, path, resty.MethodPost, params)
 	resp, err := client.R().SetContext(ctx).SetBody(params).Post(path)
 	if err != nil {
@@ -53,11 +80,7 @@ func (s *Service) Post(ctx context.Context, params map[string]interface{}, url,
 
 // PostFormData wrapper of request of method POST with form-data
 func (s *Service) PostFormData(ctx context.Context, params map[string]string, buff *bytes.Buffer, formName, fileName, url, path string, customAccessToken ...string) (*resty.Response, error) {
-	client := client.NewClient(s.jwt)
-	client.SetDebug(s.cfg.Debug)
-	client.SetBaseURL(url)
-	client.SetTimeout(time.Duration(s.cfg.Timeout) * time.Second)
-	client.GenerateAccessToken(time.Duration(s.cfg.Duration), customAccessToken...)
+	client := s.newClient(ctx, url, customAccessToken...)
 	logger.LogHTTPRequest(ctx, url, path, resty.MethodPost, nil)
 	resp, err := client.R().SetContext(ctx).SetFileReader(formName, fileName, buff).SetFormData(params).Post(path)
 	if err != nil {
@@ -69,11 +92,7 @@ func (s *Service) PostFormData(ctx context.Context, params map[string]string, bu
 
 // Patch wrapper of request of method PATCH
 func (s *Service) Patch(ctx context.Context, params map[string]interface{}, url, path string, customAccessToken ...string) (*resty.Response, error) {
-	client := client.NewClient(s.jwt)
-	client.SetDebug(s.cfg.Debug)
-	client.SetBaseURL(url)
-	client.SetTimeout(time.Duration(s.cfg.Timeout) * time.Second)
-	client.GenerateAccessToken(time.Duration(s.cfg.Duration), customAccessToken...)
+	client := s.newClient(ctx, url, customAccessToken...)
 	logger.LogHTTPRequest(ctx, url, path, resty.MethodPatch, params)
 	resp, err := client.R().SetContext(ctx).SetBody(params).Patch(path)
 	if err != nil {
@@ -85,11 +104,7 @@ func (s *Service) Patch(ctx context.Context, params map[string]interface{}, url,
 
 // PatchFormData wrapper of request of method PATCH with form-data
 func (s *Service) PatchFormData(ctx context.Context, params map[string]string, buff *bytes.Buffer, formName, fileName, url, path string, customAccessToken ...string) (*resty.Response, error) {
-	client := client.NewClient(s.jwt)
-	client.SetDebug(s.cfg.Debug)
-	client.SetBaseURL(url)
-	client.SetTimeout(time.Duration(s.cfg.Timeout) * time.Second)
-	client.GenerateAccessToken(time.Duration(s.cfg.Duration), customAccessToken...)
+	client := s.newClient(ctx, url, customAccessToken...)
 	logger.LogHTTPRequest(ctx, url, path, resty.MethodPost, nil)
 	resp, err := client.R().SetContext(ctx).SetFileReader(formName, fileName, buff).SetFormData(params).Patch(path)
 	if err != nil {
@@ -101,11 +116,7 @@ func (s *Service) PatchFormData(ctx context.Context, params map[string]string, b
 
 // Put wrapper of request of method PUT
 func (s *Service) Put(ctx context.Context, params map[string]interface{}, url, path string, customAccessToken ...string) (*resty.Response, error) {
-	client := client.NewClient(s.jwt)
-	client.SetDebug(s.cfg.Debug)
-	client.SetBaseURL(url)
-	client.SetTimeout(time.Duration(s.cfg.Timeout) * time.Second)
-	client.GenerateAccessToken(time.Duration(s.cfg.Duration), customAccessToken...)
+	client := s.newClient(ctx, url, customAccessToken...)
 	logger.LogHTTPRequest(ctx, url, path, resty.MethodPut, params)
 	resp, err := client.R().SetContext(ctx).SetBody(params).Put(path)
 	if err != nil {
@@ -117,11 +128,7 @@ func (s *Service) Put(ctx context.Context, params map[string]interface{}, url, p
 
 // Delete wrapper of request of method DELETE
 func (s *Service) Delete(ctx context.Context, params map[string]interface{}, url, path string, customAccessToken ...string) (*resty.Response, error) {
-	client := client.NewClient(s.jwt)
-	client.SetDebug(s.cfg.Debug)
-	client.SetBaseURL(url)
-	client.SetTimeout(time.Duration(s.cfg.Timeout) * time.Second)
-	client.GenerateAccessToken(time.Duration(s.cfg.Duration), customAccessToken...)
+	client := s.newClient(ctx, url, customAccessToken...)
 	logger.LogHTTPRequest(ctx, url, path, resty.MethodDelete, params)
 	resp, err := client.R().SetContext(ctx).SetBody(params).Delete(path)
 	if err != nil {
@@ -160,17 +167,34 @@ func (s *Service) InvokeLambda(ctx context.Context, functionName, path, method s
 		},
 	})
 
-	token := s.generateBasicToken(time.Duration(s.cfg.Duration))
+	ctx, span := tracing.Start(ctx, "Lambda "+method+" "+path,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.FaaSInvokedName(functionName), semconv.HTTPMethod(method)),
+	)
+	defer span.End()
 
 	// Add headers
 	reqHeaders := map[string]string{
-		"Accept":        "application/json",
-		"Content-Type":  "application/json",
-		"Authorization": fmt.Sprintf("Bearer %v", token),
+		"Accept":       "application/json",
+		"Content-Type": "application/json",
+	}
+	if s.cfg.APIKey != "" {
+		reqHeaders[apikey.HeaderAPIKey] = s.cfg.APIKey
+	} else {
+		reqHeaders["Authorization"] = fmt.Sprintf("Bearer %v", s.generateBasicToken(time.Duration(s.cfg.Duration)))
 	}
+	for key, value := range logadapter.PropagationHeaders(ctx) {
+		reqHeaders[key] = value
+	}
+	tracing.Inject(ctx, reqHeaders)
 	for key, value := range headers {
 		reqHeaders[key] = value
 	}
+	if s.cfg.Signer != nil {
+		if err := s.signLambdaRequest(reqHeaders, body, method, path); err != nil {
+			return nil, err
+		}
+	}
 
 	// Invoke Lambda function name with context
 	logger.LogHTTPRequest(ctx, functionName, path, method, body)
@@ -181,6 +205,8 @@ func (s *Service) InvokeLambda(ctx context.Context, functionName, path, method s
 	})
 	if err != nil {
 		logger.LogError(ctx, fmt.Sprintf("failed to invoke lambda function %v with err: %v", functionName, err.Error()))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return nil, err
 	}
 
@@ -194,6 +220,7 @@ func (s *Service) InvokeLambda(ctx context.Context, functionName, path, method s
 	resp.Body = strings.ReplaceAll(resp.Body, "\\n", "")
 
 	logger.LogHTTPResponse(ctx, functionName, path, []byte(resp.Body), resp.StatusCode, time.Since(timeStart))
+	span.SetAttributes(semconv.HTTPStatusCode(resp.StatusCode))
 
 	if err := s.BuildErrorInvokeLambda(resp); err != nil {
 		return nil, err
@@ -229,6 +256,25 @@ func (s *Service) generateBasicToken(duration time.Duration) string {
 	return token
 }
 
+// signLambdaRequest sets the signature headers of the request to the lambda, the body is signed as in the payload
+func (s *Service) signLambdaRequest(reqHeaders map[string]string, body map[string]interface{}, method, path string) error {
+	var bodyMarshal []byte
+	if body != nil {
+		bodyMarshal, _ = json.Marshal(body)
+	}
+	req, err := http.NewRequest(method, path, bytes.NewReader(bodyMarshal))
+	if err != nil {
+		return err
+	}
+	if err := s.cfg.Signer.Sign(req); err != nil {
+		return err
+	}
+	for _, key := range []string{secure.HeaderSignatureKeyID, secure.HeaderSignatureTimestamp, secure.HeaderSignatureNonce, secure.HeaderSignature} {
+		reqHeaders[key] = req.Header.Get(key)
+	}
+	return nil
+}
+
 func (s *Service) CreateInputPayLoad(reqHeaders map[string]string, body map[string]interface{}, method, path string) []byte {
 	payload := make(map[string]interface{})
 	payload["headers"] = reqHeaders
@@ -244,6 +290,9 @@ func (s *Service) CreateInputPayLoad(reqHeaders map[string]string, body map[stri
 
 // GenerateAccessTokenByRole to generate access token
 func (s *Service) GenerateAccessTokenByRole(id int, role string) (*string, error) {
+	if s.jwt == nil {
+		return nil, fmt.Errorf("jwt is not configured")
+	}
 	if funk.Contains([]string{
 		client.RepresentativeRole,
 		client.BranchManagerRole,
@@ -0,0 +1,67 @@
+package secret
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultCacheTTL is the default duration the secrets are cached
+const DefaultCacheTTL = time.Hour
+
+// minRefreshInterval is the min interval of refreshing a secret, so rejected credentials cannot flood the provider
+const minRefreshInterval = 30 * time.Second
+
+type cacheEntry struct {
+	value     string
+	fetchedAt time.Time
+}
+
+// Cache caches the secrets of the provider for the TTL
+type Cache struct {
+	provider Provider
+	ttl      time.Duration
+	mu       sync.RWMutex
+	entries  map[string]cacheEntry
+}
+
+// NewCache creates new cache of the provider, ttl <= 0 uses DefaultCacheTTL
+func NewCache(p Provider, ttl time.Duration) *Cache {
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	return &Cache{provider: p, ttl: ttl, entries: make(map[string]cacheEntry)}
+}
+
+// GetSecretString implements Provider
+func (c *Cache) GetSecretString(ctx context.Context, secretID string) (string, error) {
+	c.mu.RLock()
+	e, ok := c.entries[secretID]
+	c.mu.RUnlock()
+	if ok && time.Since(e.fetchedAt) < c.ttl {
+		return e.value, nil
+	}
+	return c.fetch(ctx, secretID)
+}
+
+// Refresh implements Refresher, the secret is reloaded unless it was loaded within the last 30 seconds
+func (c *Cache) Refresh(ctx context.Context, secretID string) (string, error) {
+	c.mu.RLock()
+	e, ok := c.entries[secretID]
+	c.mu.RUnlock()
+	if ok && time.Since(e.fetchedAt) < minRefreshInterval {
+		return e.value, nil
+	}
+	return c.fetch(ctx, secretID)
+}
+
+func (c *Cache) fetch(ctx context.Context, secretID string) (string, error) {
+	val, err := c.provider.GetSecretString(ctx, secretID)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	c.entries[secretID] = cacheEntry{value: val, fetchedAt: time.Now()}
+	c.mu.Unlock()
+	return val, nil
+}
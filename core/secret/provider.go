@@ -0,0 +1,143 @@
+package secret
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+)
+
+// AWSProvider reads the secrets from AWS Secrets Manager, the client is created on first use
+type AWSProvider struct {
+	region string
+	once   sync.Once
+	client *secretsmanager.SecretsManager
+	err    error
+}
+
+// NewAWSProvider creates new Secrets Manager provider, empty region uses the region of the environment
+func NewAWSProvider(region string) *AWSProvider {
+	return &AWSProvider{region: region}
+}
+
+// GetSecretString implements Provider
+func (p *AWSProvider) GetSecretString(ctx context.Context, secretID string) (string, error) {
+	p.once.Do(func() {
+		cfg := aws.NewConfig()
+		if p.region != "" {
+			cfg = cfg.WithRegion(p.region)
+		}
+		var s *session.Session
+		if s, p.err = session.NewSessionWithOptions(session.Options{Config: *cfg, SharedConfigState: session.SharedConfigEnable}); p.err == nil {
+			p.client = secretsmanager.New(s)
+		}
+	})
+	if p.err != nil {
+		return "", p.err
+	}
+
+	out, err := p.client.GetSecretValueWithContext(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(secretID)})
+	if err != nil {
+		var notFound *secretsmanager.ResourceNotFoundException
+		if errors.As(err, &notFound) {
+			return "", fmt.Errorf("%w: %s", ErrNotFound, secretID)
+		}
+		return "", err
+	}
+	if out.SecretString != nil {
+		return *out.SecretString, nil
+	}
+	return string(out.SecretBinary), nil
+}
+
+// EnvProvider reads the secrets from environment variables, named by the uppercased secret ID
+// with non-alphanumeric characters replaced by underscores, e.g. "tabi/basic-token" is TABI_BASIC_TOKEN
+type EnvProvider struct {
+	prefix string
+}
+
+// NewEnvProvider creates new env provider, the prefix is prepended to the variable names, e.g. "SECRET_"
+func NewEnvProvider(prefix string) *EnvProvider {
+	return &EnvProvider{prefix: prefix}
+}
+
+// GetSecretString implements Provider
+func (p *EnvProvider) GetSecretString(ctx context.Context, secretID string) (string, error) {
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, strings.ToUpper(secretID))
+	val, ok := os.LookupEnv(p.prefix + name)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, secretID)
+	}
+	return val, nil
+}
+
+// FileProvider reads the secrets from the files of a directory, the secret ID is the relative path of the file
+type FileProvider struct {
+	dir string
+}
+
+// NewFileProvider creates new file provider
+func NewFileProvider(dir string) *FileProvider {
+	return &FileProvider{dir: dir}
+}
+
+// GetSecretString implements Provider
+func (p *FileProvider) GetSecretString(ctx context.Context, secretID string) (string, error) {
+	path := filepath.Join(p.dir, filepath.FromSlash(secretID))
+	if rel, err := filepath.Rel(p.dir, path); err != nil || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("invalid secret id %s", secretID)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("%w: %s", ErrNotFound, secretID)
+		}
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// MemoryProvider holds the secrets in memory, e.g. in tests
+type MemoryProvider struct {
+	mu      sync.RWMutex
+	secrets map[string]string
+}
+
+// NewMemoryProvider creates new in-memory provider with the secrets
+func NewMemoryProvider(secrets map[string]string) *MemoryProvider {
+	p := &MemoryProvider{secrets: make(map[string]string)}
+	for id, val := range secrets {
+		p.secrets[id] = val
+	}
+	return p
+}
+
+// Set sets the secret, e.g. to simulate a rotation
+func (p *MemoryProvider) Set(secretID, value string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.secrets[secretID] = value
+}
+
+// GetSecretString implements Provider
+func (p *MemoryProvider) GetSecretString(ctx context.Context, secretID string) (string, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	val, ok := p.secrets[secretID]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, secretID)
+	}
+	return val, nil
+}
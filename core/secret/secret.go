@@ -0,0 +1,66 @@
+package secret
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound is returned when the secret does not exist
+var ErrNotFound = errors.New("secret not found")
+
+// Provider provides the secrets by ID, e.g. the Secrets Manager secret name
+type Provider interface {
+	GetSecretString(ctx context.Context, secretID string) (string, error)
+}
+
+// Refresher is implemented by the caching providers, to reload a secret when it may have been rotated,
+// e.g. when the credentials in the cache are rejected
+type Refresher interface {
+	Refresh(ctx context.Context, secretID string) (string, error)
+}
+
+// Refresh reloads the secret when the provider caches it, otherwise it reads the secret again
+func Refresh(ctx context.Context, p Provider, secretID string) (string, error) {
+	if r, ok := p.(Refresher); ok {
+		return r.Refresh(ctx, secretID)
+	}
+	return p.GetSecretString(ctx, secretID)
+}
+
+// GetJSON reads the JSON secret into out
+func GetJSON(ctx context.Context, p Provider, secretID string, out interface{}) error {
+	str, err := p.GetSecretString(ctx, secretID)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(str), out); err != nil {
+		return fmt.Errorf("invalid secret %s: %w", secretID, err)
+	}
+	return nil
+}
+
+// RefreshJSON reloads the JSON secret into out
+func RefreshJSON(ctx context.Context, p Provider, secretID string, out interface{}) error {
+	str, err := Refresh(ctx, p, secretID)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(str), out); err != nil {
+		return fmt.Errorf("invalid secret %s: %w", secretID, err)
+	}
+	return nil
+}
+
+var defaultProvider Provider = NewCache(NewAWSProvider(""), DefaultCacheTTL)
+
+// Default returns the default provider, the cached AWS Secrets Manager provider unless set
+func Default() Provider {
+	return defaultProvider
+}
+
+// SetDefault sets the default provider, e.g. the env or file provider for local development and tests
+func SetDefault(p Provider) {
+	defaultProvider = p
+}
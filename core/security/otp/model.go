@@ -0,0 +1,40 @@
+package otp
+
+import "time"
+
+// Code represents a one-time password sent to a subject, only the hash of the code is stored.
+// It can be used to migrate the tables, e.g. db.AutoMigrate(&otp.Code{}, &otp.TOTPSecret{})
+type Code struct {
+	ID int `json:"id" gorm:"primaryKey"`
+	// Purpose separates the codes of different flows, e.g. "login" or "reset_password"
+	Purpose string `json:"purpose" gorm:"type:varchar(50);not null;index:idx_otp_codes_purpose_subject"`
+	// Subject is the receiver of the code, e.g. the phone number or the email
+	Subject    string     `json:"subject" gorm:"type:varchar(255);not null;index:idx_otp_codes_purpose_subject"`
+	CodeHash   string     `json:"-" gorm:"type:varchar(64);not null"`
+	Attempts   int        `json:"attempts" gorm:"not null;default:0"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"index"`
+	ConsumedAt *time.Time `json:"consumed_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// TableName returns the table of the codes
+func (Code) TableName() string {
+	return "otp_codes"
+}
+
+// TOTPSecret represents the TOTP secret of a subject, encrypted with the encryption key of the config
+type TOTPSecret struct {
+	ID              int    `json:"id" gorm:"primaryKey"`
+	Subject         string `json:"subject" gorm:"type:varchar(255);not null;uniqueIndex"`
+	SecretEncrypted []byte `json:"-" gorm:"type:bytea;not null"`
+	// LastUsedStep is the time step of the last accepted code, so a code cannot be used twice
+	LastUsedStep int64      `json:"-" gorm:"not null;default:0"`
+	ConfirmedAt  *time.Time `json:"confirmed_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// TableName returns the table of the TOTP secrets
+func (TOTPSecret) TableName() string {
+	return "totp_secrets"
+}
@@ -0,0 +1,224 @@
+package otp
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"time"
+
+	dbcore "github.com/namhoai1109/tabi/core/db"
+	"github.com/namhoai1109/tabi/core/middleware/secure"
+	"github.com/namhoai1109/tabi/core/server"
+
+	"gorm.io/gorm"
+)
+
+// OTP errors
+var (
+	ErrInvalidCode     = server.NewHTTPValidationError("The code is invalid or has expired")
+	ErrTooManyAttempts = server.NewHTTPError(http.StatusTooManyRequests, server.GenericErrorType, "Too many attempts, please request a new code")
+)
+
+// Config represents the config of the OTP service
+type Config struct {
+	// DB stores the codes and the TOTP secrets
+	DB *gorm.DB
+	// Length is the number of digits of the codes, default is 6
+	Length int
+	// TTL is the lifetime of the codes, default is 5 minutes
+	TTL time.Duration
+	// MaxAttempts is the max wrong attempts of a code, default is 5
+	MaxAttempts int
+	// HashKey is the HMAC key hashing the codes, so the stored hashes cannot be brute forced without it. Required
+	HashKey []byte
+	// RateLimitStore keeps the throttling states, default is the in-memory store.
+	// Use the Postgres store to share the limits across Lambda instances.
+	RateLimitStore secure.RateLimitStore
+	// SendLimit throttles the codes sent to a subject, default is 3 per 10 minutes
+	SendLimit secure.RateLimitStrategy
+	// VerifyLimit throttles the verifications of a subject across codes, default is 10 per hour
+	VerifyLimit secure.RateLimitStrategy
+	// TOTPIssuer is the issuer shown in the authenticator apps, e.g. "Tabi"
+	TOTPIssuer string
+	// EncryptionKey is the AES key (16, 24 or 32 bytes) encrypting the TOTP secrets, required for TOTP
+	EncryptionKey []byte
+}
+
+// DefaultConfig is the default OTP config
+var DefaultConfig = Config{
+	Length:      6,
+	TTL:         5 * time.Minute,
+	MaxAttempts: 5,
+	SendLimit:   secure.SlidingWindow{Limit: 3, Window: 10 * time.Minute},
+	VerifyLimit: secure.SlidingWindow{Limit: 10, Window: time.Hour},
+	TOTPIssuer:  "Tabi",
+}
+
+// Service generates and verifies the one-time passwords
+type Service struct {
+	cfg           Config
+	sendLimiter   *secure.RateLimiter
+	verifyLimiter *secure.RateLimiter
+}
+
+// New creates new OTP service with the default config and the HMAC key of the codes, e.g. from the secret provider
+func New(db *gorm.DB, hashKey []byte) *Service {
+	cfg := DefaultConfig
+	cfg.DB = db
+	cfg.HashKey = hashKey
+	return NewWithConfig(cfg)
+}
+
+// NewWithConfig creates new OTP service with config, it panics without HashKey
+func NewWithConfig(cfg Config) *Service {
+	if len(cfg.HashKey) == 0 {
+		panic("otp: HashKey is required to hash the codes")
+	}
+	if cfg.Length <= 0 {
+		cfg.Length = DefaultConfig.Length
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultConfig.TTL
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultConfig.MaxAttempts
+	}
+	if cfg.RateLimitStore == nil {
+		cfg.RateLimitStore = secure.NewMemoryRateLimitStore()
+	}
+	if cfg.SendLimit == nil {
+		cfg.SendLimit = DefaultConfig.SendLimit
+	}
+	if cfg.VerifyLimit == nil {
+		cfg.VerifyLimit = DefaultConfig.VerifyLimit
+	}
+	if cfg.TOTPIssuer == "" {
+		cfg.TOTPIssuer = DefaultConfig.TOTPIssuer
+	}
+	return &Service{
+		cfg:           cfg,
+		sendLimiter:   secure.NewRateLimiter(cfg.RateLimitStore, cfg.SendLimit),
+		verifyLimiter: secure.NewRateLimiter(cfg.RateLimitStore, cfg.VerifyLimit),
+	}
+}
+
+// Generate generates new code of the purpose for the subject, to be sent by SMS or email.
+// The previous codes of the purpose are invalidated.
+func (s *Service) Generate(ctx context.Context, purpose, subject string) (string, time.Time, error) {
+	if err := throttle(ctx, s.sendLimiter, "otp:send:"+purpose+":"+subject); err != nil {
+		return "", time.Time{}, err
+	}
+
+	code, err := randomDigits(s.cfg.Length)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	now := time.Now()
+	rec := &Code{
+		Purpose:   purpose,
+		Subject:   subject,
+		CodeHash:  s.hashCode(purpose, subject, code),
+		ExpiresAt: now.Add(s.cfg.TTL),
+	}
+	err = s.cfg.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := dbcore.NewDB(&Code{}).Update(tx, map[string]interface{}{"consumed_at": now},
+			"purpose = ? AND subject = ? AND consumed_at IS NULL", purpose, subject); err != nil {
+			return err
+		}
+		return dbcore.NewDB(&Code{}).Create(tx, rec)
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return code, rec.ExpiresAt, nil
+}
+
+// Verify consumes the code of the purpose for the subject.
+// ErrInvalidCode is returned when the code is wrong or expired, ErrTooManyAttempts when the code is locked.
+func (s *Service) Verify(ctx context.Context, purpose, subject, code string) error {
+	if err := throttle(ctx, s.verifyLimiter, "otp:verify:"+purpose+":"+subject); err != nil {
+		return err
+	}
+
+	db := s.cfg.DB.WithContext(ctx)
+	now := time.Now()
+	rec := new(Code)
+	if err := dbcore.NewDB(&Code{}).View(db.Order("id DESC"), rec,
+		"purpose = ? AND subject = ? AND consumed_at IS NULL AND expires_at > ?", purpose, subject, now); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidCode
+		}
+		return err
+	}
+	if rec.Attempts >= s.cfg.MaxAttempts {
+		return ErrTooManyAttempts
+	}
+
+	if !hmac.Equal([]byte(s.hashCode(purpose, subject, code)), []byte(rec.CodeHash)) {
+		// the attempts are counted in the update, as concurrent guesses may all pass the check above
+		res := db.Model(&Code{}).Where("id = ? AND attempts < ?", rec.ID, s.cfg.MaxAttempts).
+			Update("attempts", gorm.Expr("attempts + 1"))
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 || rec.Attempts+1 >= s.cfg.MaxAttempts {
+			return ErrTooManyAttempts
+		}
+		return ErrInvalidCode
+	}
+
+	// consume once, concurrent verifications of the same code and the locked code are rejected
+	res := db.Model(&Code{}).Where("id = ? AND consumed_at IS NULL AND attempts < ?", rec.ID, s.cfg.MaxAttempts).
+		Update("consumed_at", now)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+// DeleteExpired deletes the expired codes, e.g. in a scheduled job
+func (s *Service) DeleteExpired(ctx context.Context) error {
+	return dbcore.NewDB(&Code{}).Delete(s.cfg.DB.WithContext(ctx), "expires_at < ?", time.Now())
+}
+
+// hashCode hashes the code bound to its purpose and subject
+func (s *Service) hashCode(purpose, subject, code string) string {
+	mac := hmac.New(sha256.New, s.cfg.HashKey)
+	mac.Write([]byte(purpose + ":" + subject + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// throttle returns 429 error with the retry after seconds when the key is limited
+func throttle(ctx context.Context, limiter *secure.RateLimiter, key string) error {
+	allowed, retryAfter, err := limiter.Allow(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		seconds := int(math.Ceil(retryAfter.Seconds()))
+		err := server.NewHTTPError(http.StatusTooManyRequests, server.GenericErrorType,
+			fmt.Sprintf("Too many requests, please try again after %d seconds", seconds))
+		err.Extensions = map[string]interface{}{"retry_after": seconds}
+		return err
+	}
+	return nil
+}
+
+// randomDigits generates a uniformly random numeric code
+func randomDigits(length int) (string, error) {
+	n, err := rand.Int(rand.Reader, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(length)), nil))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*s", length, n.String()), nil
+}
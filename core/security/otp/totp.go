@@ -0,0 +1,227 @@
+package otp
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"time"
+
+	dbcore "github.com/namhoai1109/tabi/core/db"
+	"github.com/namhoai1109/tabi/core/server"
+
+	"gorm.io/gorm"
+)
+
+// TOTP parameters, the defaults of RFC 6238 supported by all authenticator apps
+const (
+	TOTPDigits = 6
+	TOTPPeriod = 30 * time.Second
+	// TOTPSkew is the number of periods accepted before and after the current one, for the clock drift
+	TOTPSkew = 1
+	// totpSecretSize is the size of the generated secrets, 160 bits as recommended for HMAC-SHA1
+	totpSecretSize = 20
+)
+
+// TOTP errors
+var (
+	ErrTOTPEnrolled    = server.NewHTTPValidationError("Two-factor authentication is already enabled")
+	ErrTOTPNotEnrolled = server.NewHTTPValidationError("Two-factor authentication is not enabled")
+	errNoEncryptionKey = errors.New("otp: encryption key is required for TOTP")
+)
+
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TOTPEnrollment represents the secret to be added to the authenticator app, usually shown as a QR code of the URI
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// TOTPCode returns the RFC 6238 code of the secret at the time
+func TOTPCode(secret []byte, t time.Time) string {
+	return hotp(secret, totpStep(t))
+}
+
+// EnrollTOTP generates new TOTP secret for the subject, e.g. the admin account ID, shown as the account in the app.
+// The secret is not active until confirmed by ConfirmTOTP with a code from the app.
+func (s *Service) EnrollTOTP(ctx context.Context, subject, account string) (*TOTPEnrollment, error) {
+	db := s.cfg.DB.WithContext(ctx)
+	if exist, err := dbcore.NewDB(&TOTPSecret{}).Exist(db, "subject = ? AND confirmed_at IS NOT NULL", subject); err != nil {
+		return nil, err
+	} else if exist {
+		return nil, ErrTOTPEnrolled
+	}
+
+	secret := make([]byte, totpSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	encrypted, err := s.encrypt(secret)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := dbcore.NewDB(&TOTPSecret{}).DeletePermanently(tx, "subject = ? AND confirmed_at IS NULL", subject); err != nil {
+			return err
+		}
+		return dbcore.NewDB(&TOTPSecret{}).Create(tx, &TOTPSecret{Subject: subject, SecretEncrypted: encrypted})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := base32NoPadding.EncodeToString(secret)
+	query := url.Values{}
+	query.Set("secret", encoded)
+	query.Set("issuer", s.cfg.TOTPIssuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", strconv.Itoa(TOTPDigits))
+	query.Set("period", strconv.Itoa(int(TOTPPeriod.Seconds())))
+	uri := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + s.cfg.TOTPIssuer + ":" + account,
+		RawQuery: query.Encode(),
+	}
+	return &TOTPEnrollment{Secret: encoded, URI: uri.String()}, nil
+}
+
+// ConfirmTOTP activates the enrolled secret of the subject with a code from the app
+func (s *Service) ConfirmTOTP(ctx context.Context, subject, code string) error {
+	return s.verifyTOTP(ctx, subject, code, false)
+}
+
+// VerifyTOTP verifies the code of the subject, each code is accepted once
+func (s *Service) VerifyTOTP(ctx context.Context, subject, code string) error {
+	return s.verifyTOTP(ctx, subject, code, true)
+}
+
+// HasTOTP checks whether the subject has an active TOTP secret, e.g. to require the code on login
+func (s *Service) HasTOTP(ctx context.Context, subject string) (bool, error) {
+	return dbcore.NewDB(&TOTPSecret{}).Exist(s.cfg.DB.WithContext(ctx), "subject = ? AND confirmed_at IS NOT NULL", subject)
+}
+
+// DisableTOTP deletes the TOTP secret of the subject
+func (s *Service) DisableTOTP(ctx context.Context, subject string) error {
+	return dbcore.NewDB(&TOTPSecret{}).DeletePermanently(s.cfg.DB.WithContext(ctx), "subject = ?", subject)
+}
+
+func (s *Service) verifyTOTP(ctx context.Context, subject, code string, confirmed bool) error {
+	if err := throttle(ctx, s.verifyLimiter, "otp:totp:"+subject); err != nil {
+		return err
+	}
+
+	db := s.cfg.DB.WithContext(ctx)
+	cond := "subject = ? AND confirmed_at IS NULL"
+	if confirmed {
+		cond = "subject = ? AND confirmed_at IS NOT NULL"
+	}
+	rec := new(TOTPSecret)
+	if err := dbcore.NewDB(&TOTPSecret{}).View(db, rec, cond, subject); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrTOTPNotEnrolled
+		}
+		return err
+	}
+	secret, err := s.decrypt(rec.SecretEncrypted)
+	if err != nil {
+		return err
+	}
+
+	step, ok := matchStep(secret, code, time.Now())
+	if !ok || step <= rec.LastUsedStep {
+		return ErrInvalidCode
+	}
+
+	// the step only moves forward, so a code replayed concurrently is rejected
+	updates := map[string]interface{}{"last_used_step": step}
+	if !confirmed {
+		updates["confirmed_at"] = time.Now()
+	}
+	res := db.Model(&TOTPSecret{}).Where("id = ? AND last_used_step < ?", rec.ID, step).Updates(updates)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+// matchStep returns the step within the skew matching the code
+func matchStep(secret []byte, code string, now time.Time) (int64, bool) {
+	current := totpStep(now)
+	for i := -TOTPSkew; i <= TOTPSkew; i++ {
+		step := current + int64(i)
+		if hmac.Equal([]byte(hotp(secret, step)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func totpStep(t time.Time) int64 {
+	return t.Unix() / int64(TOTPPeriod.Seconds())
+}
+
+// hotp returns the RFC 4226 code of the counter
+func hotp(secret []byte, counter int64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(counter))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < TOTPDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", TOTPDigits, value%mod)
+}
+
+// encrypt encrypts the secret with AES-GCM, the nonce is prepended to the cipher text
+func (s *Service) encrypt(plain []byte) ([]byte, error) {
+	gcm, err := s.gcm()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plain, nil), nil
+}
+
+func (s *Service) decrypt(data []byte) ([]byte, error) {
+	gcm, err := s.gcm()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("otp: invalid encrypted secret")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+}
+
+func (s *Service) gcm() (cipher.AEAD, error) {
+	if len(s.cfg.EncryptionKey) == 0 {
+		return nil, errNoEncryptionKey
+	}
+	block, err := aes.NewCipher(s.cfg.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
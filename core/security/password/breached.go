@@ -0,0 +1,80 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+//go:embed breached.txt
+var commonPasswords string
+
+// BreachedList is a local list of the breached passwords.
+// The lines are either the plain passwords or the SHA-1 hex of the passwords as in the
+// Have I Been Pwned downloads, e.g. "7C4A8D09CA3762AF61E59520943DC26494F8941B:24230577"
+type BreachedList struct {
+	mu     sync.RWMutex
+	hashes map[string]struct{}
+}
+
+// NewBreachedList creates new list with the embedded common passwords
+func NewBreachedList() *BreachedList {
+	l := &BreachedList{hashes: map[string]struct{}{}}
+	l.Load(strings.NewReader(commonPasswords))
+	return l
+}
+
+// Load adds the passwords or the hashes of the reader, one per line
+func (l *BreachedList) Load(r io.Reader) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if hash, _, _ := strings.Cut(line, ":"); isSHA1Hex(hash) {
+			l.hashes[strings.ToUpper(hash)] = struct{}{}
+			continue
+		}
+		l.hashes[sha1Hex(line)] = struct{}{}
+	}
+	return scanner.Err()
+}
+
+// LoadFile adds the passwords or the hashes of the file, e.g. bundled with the service
+func (l *BreachedList) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return l.Load(f)
+}
+
+// Contains checks whether the password is in the list
+func (l *BreachedList) Contains(password string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	_, ok := l.hashes[sha1Hex(password)]
+	return ok
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func isSHA1Hex(s string) bool {
+	if len(s) != 2*sha1.Size {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
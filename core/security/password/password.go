@@ -0,0 +1,209 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Hashing algorithms
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+)
+
+// Password errors
+var (
+	ErrMismatch    = errors.New("password: mismatch")
+	ErrInvalidHash = errors.New("password: invalid hash")
+)
+
+// Argon2Params represents the argon2id parameters, Memory is in KiB
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// Config represents the config of the hasher
+type Config struct {
+	// Algorithm hashes the new passwords, default is Argon2id.
+	// The hashes of the other algorithm are still verified and rehashed on login.
+	Algorithm string
+	Argon2    Argon2Params
+	// BcryptCost is the cost of bcrypt, default is 12
+	BcryptCost int
+}
+
+// DefaultConfig is the default hasher config, the argon2id parameters follow the OWASP recommendation
+var DefaultConfig = Config{
+	Algorithm: Argon2id,
+	Argon2: Argon2Params{
+		Memory:      64 * 1024,
+		Iterations:  3,
+		Parallelism: 2,
+		SaltLength:  16,
+		KeyLength:   32,
+	},
+	BcryptCost: 12,
+}
+
+// Hasher hashes and verifies the passwords
+type Hasher struct {
+	cfg Config
+}
+
+// New creates new hasher with the default config
+func New() *Hasher {
+	return NewWithConfig(DefaultConfig)
+}
+
+// NewWithConfig creates new hasher with config
+func NewWithConfig(cfg Config) *Hasher {
+	if cfg.Algorithm == "" {
+		cfg.Algorithm = DefaultConfig.Algorithm
+	}
+	if cfg.Argon2 == (Argon2Params{}) {
+		cfg.Argon2 = DefaultConfig.Argon2
+	}
+	if cfg.BcryptCost == 0 {
+		cfg.BcryptCost = DefaultConfig.BcryptCost
+	}
+	return &Hasher{cfg: cfg}
+}
+
+var defaultHasher = New()
+
+// Get returns the default hasher
+func Get() *Hasher {
+	return defaultHasher
+}
+
+// Set sets the default hasher, e.g. with cheaper parameters for the Lambda functions with less memory
+func Set(h *Hasher) {
+	defaultHasher = h
+}
+
+// Algorithm returns the algorithm hashing the new passwords
+func (h *Hasher) Algorithm() string {
+	return h.cfg.Algorithm
+}
+
+// Hash hashes the password with the default hasher
+func Hash(password string) (string, error) {
+	return defaultHasher.Hash(password)
+}
+
+// Verify verifies the password with the default hasher, see Hasher.Verify
+func Verify(password, hash string) (string, error) {
+	return defaultHasher.Verify(password, hash)
+}
+
+// Hash hashes the password, the argon2id hashes are encoded in the PHC format:
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+func (h *Hasher) Hash(password string) (string, error) {
+	if h.cfg.Algorithm == Bcrypt {
+		b, err := bcrypt.GenerateFromPassword([]byte(password), h.cfg.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+
+	p := h.cfg.Argon2
+	salt := make([]byte, p.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", Argon2id, argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify verifies the password against the hash, returning ErrMismatch when it is wrong.
+// When the hash was made with another algorithm or other parameters, the password is rehashed
+// and the new hash is returned to be saved, otherwise the returned hash is empty.
+func (h *Hasher) Verify(password, hash string) (string, error) {
+	if isBcrypt(hash) {
+		if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+			if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+				return "", ErrMismatch
+			}
+			return "", ErrInvalidHash
+		}
+	} else {
+		p, salt, key, err := decodeArgon2(hash)
+		if err != nil {
+			return "", err
+		}
+		other := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+		if subtle.ConstantTimeCompare(key, other) != 1 {
+			return "", ErrMismatch
+		}
+	}
+
+	if !h.NeedsRehash(hash) {
+		return "", nil
+	}
+	newHash, err := h.Hash(password)
+	if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		// the password cannot be moved to bcrypt, the current hash is kept
+		return "", nil
+	}
+	return newHash, err
+}
+
+// NeedsRehash checks whether the hash was made with another algorithm or other parameters than the config
+func (h *Hasher) NeedsRehash(hash string) bool {
+	if isBcrypt(hash) {
+		if h.cfg.Algorithm != Bcrypt {
+			return true
+		}
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err != nil || cost != h.cfg.BcryptCost
+	}
+	if h.cfg.Algorithm != Argon2id {
+		return true
+	}
+	p, _, _, err := decodeArgon2(hash)
+	return err != nil || p != h.cfg.Argon2
+}
+
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+// decodeArgon2 decodes the parameters, the salt and the key of the argon2id hash
+func decodeArgon2(hash string) (Argon2Params, []byte, []byte, error) {
+	var p Argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != Argon2id {
+		return p, nil, nil, ErrInvalidHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, ErrInvalidHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+	return p, salt, key, nil
+}
@@ -0,0 +1,107 @@
+package password
+
+import (
+	"errors"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Policy errors
+var (
+	ErrTooShort      = errors.New("password: too short")
+	ErrTooLong       = errors.New("password: too long")
+	ErrMissingUpper  = errors.New("password: missing upper case letter")
+	ErrMissingLower  = errors.New("password: missing lower case letter")
+	ErrMissingDigit  = errors.New("password: missing digit")
+	ErrMissingSymbol = errors.New("password: missing symbol")
+	ErrBreached      = errors.New("password: found in breached passwords")
+)
+
+// Policy represents the strength policy of the passwords, the lengths are in characters.
+// The passwords longer than 72 bytes are rejected when the default hasher uses bcrypt.
+type Policy struct {
+	MinLength     int
+	MaxLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// Breached rejects the passwords of the list, nil disables the check
+	Breached *BreachedList
+}
+
+// DefaultPolicy is the default strength policy, the max length bounds the hashing cost
+var DefaultPolicy = Policy{
+	MinLength:    8,
+	MaxLength:    128,
+	RequireUpper: true,
+	RequireLower: true,
+	RequireDigit: true,
+	Breached:     NewBreachedList(),
+}
+
+// bcryptMaxBytes is the max password length of bcrypt, the longer passwords cannot be hashed
+const bcryptMaxBytes = 72
+
+var defaultPolicy = DefaultPolicy
+
+// GetPolicy returns the policy of the `password` validator tag
+func GetPolicy() Policy {
+	return defaultPolicy
+}
+
+// SetPolicy sets the policy of the `password` validator tag
+func SetPolicy(p Policy) {
+	defaultPolicy = p
+}
+
+// EffectiveMaxLength returns the max length, capped to the 72 bytes of bcrypt when the default hasher uses it
+func (p Policy) EffectiveMaxLength() int {
+	if Get().Algorithm() == Bcrypt && (p.MaxLength <= 0 || p.MaxLength > bcryptMaxBytes) {
+		return bcryptMaxBytes
+	}
+	return p.MaxLength
+}
+
+// Validate returns the first rule the password breaks, nil when it is strong enough
+func (p Policy) Validate(password string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		return ErrTooShort
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		return ErrTooLong
+	}
+	if Get().Algorithm() == Bcrypt && len(password) > bcryptMaxBytes {
+		return ErrTooLong
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	switch {
+	case p.RequireUpper && !upper:
+		return ErrMissingUpper
+	case p.RequireLower && !lower:
+		return ErrMissingLower
+	case p.RequireDigit && !digit:
+		return ErrMissingDigit
+	case p.RequireSymbol && !symbol:
+		return ErrMissingSymbol
+	}
+
+	if p.Breached != nil && p.Breached.Contains(password) {
+		return ErrBreached
+	}
+	return nil
+}
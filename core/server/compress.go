@@ -0,0 +1,251 @@
+package server
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// Supported content encodings, in order of preference
+const (
+	EncodingBrotli  = "br"
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+)
+
+// DefaultCompressMinLength is the default min response size to be compressed, smaller ones are not worth it
+const DefaultCompressMinLength = 1024
+
+// CompressConfig represents the config of the compression middleware
+type CompressConfig struct {
+	Skipper middleware.Skipper
+	// MinLength is the min response size (in bytes) to be compressed, default is DefaultCompressMinLength
+	MinLength int
+	// Encodings are the enabled encodings in order of preference, default are br, gzip and deflate
+	Encodings []string
+}
+
+// compressedTypes are the content types which are compressed already
+var compressedTypes = []string{
+	"image/", "video/", "audio/", "font/woff",
+	"application/zip", "application/gzip", "application/x-gzip", "application/pdf",
+	"application/octet-stream", "application/x-7z-compressed", "application/x-rar-compressed",
+}
+
+// Compress returns a middleware which compresses the responses with the encoding accepted by the client
+func Compress() echo.MiddlewareFunc {
+	return CompressWithConfig(CompressConfig{})
+}
+
+// CompressWithConfig returns the compression middleware with config.
+// Responses smaller than MinLength, already encoded or of compressed content types are sent as is.
+func CompressWithConfig(cfg CompressConfig) echo.MiddlewareFunc {
+	if cfg.Skipper == nil {
+		cfg.Skipper = middleware.DefaultSkipper
+	}
+	if cfg.MinLength <= 0 {
+		cfg.MinLength = DefaultCompressMinLength
+	}
+	if cfg.Encodings == nil {
+		cfg.Encodings = []string{EncodingBrotli, EncodingGzip, EncodingDeflate}
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if cfg.Skipper(c) || req.Method == http.MethodHead {
+				return next(c)
+			}
+			res := c.Response()
+			res.Header().Add(echo.HeaderVary, echo.HeaderAcceptEncoding)
+			encoding := negotiateEncoding(req.Header.Get(echo.HeaderAcceptEncoding), cfg.Encodings)
+			if encoding == "" {
+				return next(c)
+			}
+
+			writer := &compressWriter{ResponseWriter: res.Writer, encoding: encoding, minLength: cfg.MinLength, code: http.StatusOK}
+			res.Writer = writer
+			defer func() {
+				if err := writer.close(); err != nil {
+					c.Logger().Error(err)
+				}
+				res.Writer = writer.ResponseWriter
+			}()
+			return next(c)
+		}
+	}
+}
+
+// negotiateEncoding returns the enabled encoding with the highest quality in the Accept-Encoding header
+func negotiateEncoding(header string, encodings []string) string {
+	if header == "" {
+		return ""
+	}
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		quality := 1.0
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			if v, err := strconv.ParseFloat(strings.TrimPrefix(params, "q="), 64); err == nil {
+				quality = v
+			}
+		}
+		qualities[strings.ToLower(strings.TrimSpace(name))] = quality
+	}
+
+	best, bestQuality := "", 0.0
+	for _, enc := range encodings {
+		quality, ok := qualities[enc]
+		if !ok {
+			quality, ok = qualities["*"]
+		}
+		if ok && quality > bestQuality {
+			best, bestQuality = enc, quality
+		}
+	}
+	return best
+}
+
+// compressWriter buffers the response until MinLength is reached, then decides whether to compress it
+type compressWriter struct {
+	http.ResponseWriter
+	encoding  string
+	minLength int
+	code      int
+	buf       bytes.Buffer
+	encoder   io.WriteCloser
+	// wroteHeader is set when the header is sent to the client, compressed or not
+	wroteHeader bool
+	headerSet   bool
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.headerSet {
+		return
+	}
+	w.headerSet = true
+	w.code = code
+	// responses without body are sent as is
+	if code < http.StatusOK || code == http.StatusNoContent || code == http.StatusNotModified {
+		w.sendHeader(false)
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.headerSet {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.wroteHeader {
+		if w.encoder != nil {
+			return w.encoder.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+
+	w.buf.Write(b)
+	if w.buf.Len() < w.minLength {
+		return len(b), nil
+	}
+	if err := w.start(w.compressible()); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Flush sends the buffered response, compressing it if compressible
+func (w *compressWriter) Flush() {
+	if !w.wroteHeader {
+		if err := w.start(w.buf.Len() >= w.minLength && w.compressible()); err != nil {
+			return
+		}
+	}
+	if f, ok := w.encoder.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// compressible reports whether the response is neither encoded nor of a compressed content type
+func (w *compressWriter) compressible() bool {
+	header := w.Header()
+	if header.Get(echo.HeaderContentEncoding) != "" {
+		return false
+	}
+	contentType := strings.ToLower(header.Get(echo.HeaderContentType))
+	if contentType == "" {
+		contentType = http.DetectContentType(w.buf.Bytes())
+	}
+	if strings.HasPrefix(contentType, "image/svg") {
+		return true
+	}
+	for _, t := range compressedTypes {
+		if strings.HasPrefix(contentType, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// start sends the header and the buffered response
+func (w *compressWriter) start(compress bool) error {
+	if compress {
+		var err error
+		switch w.encoding {
+		case EncodingBrotli:
+			w.encoder = brotli.NewWriter(w.ResponseWriter)
+		case EncodingGzip:
+			w.encoder = gzip.NewWriter(w.ResponseWriter)
+		case EncodingDeflate:
+			w.encoder, err = flate.NewWriter(w.ResponseWriter, flate.DefaultCompression)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	w.sendHeader(w.encoder != nil)
+
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	var err error
+	if w.encoder != nil {
+		_, err = w.encoder.Write(w.buf.Bytes())
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf.Bytes())
+	}
+	w.buf.Reset()
+	return err
+}
+
+func (w *compressWriter) sendHeader(compressed bool) {
+	w.wroteHeader = true
+	if compressed {
+		w.Header().Set(echo.HeaderContentEncoding, w.encoding)
+		w.Header().Del(echo.HeaderContentLength)
+	}
+	w.ResponseWriter.WriteHeader(w.code)
+}
+
+// close sends the response smaller than MinLength as is, or completes the compressed stream
+func (w *compressWriter) close() error {
+	if !w.headerSet {
+		return nil
+	}
+	if !w.wroteHeader {
+		return w.start(false)
+	}
+	if w.encoder != nil {
+		return w.encoder.Close()
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// MIMETextCSV is the content type of CSV responses
+const MIMETextCSV = "text/csv"
+
+// WantsCSV reports whether the Accept header of the request prefers CSV over JSON
+func WantsCSV(c echo.Context) bool {
+	csvQuality, jsonQuality := 0.0, 0.0
+	for _, part := range strings.Split(c.Request().Header.Get(echo.HeaderAccept), ",") {
+		mime, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		quality := 1.0
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			if v, err := strconv.ParseFloat(strings.TrimPrefix(params, "q="), 64); err == nil {
+				quality = v
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(mime)) {
+		case MIMETextCSV:
+			csvQuality = quality
+		case echo.MIMEApplicationJSON:
+			jsonQuality = quality
+		}
+	}
+	return csvQuality > 0 && csvQuality >= jsonQuality
+}
+
+// RenderCSV renders the slice of structs or maps as CSV, with the json names of the fields as header row
+func RenderCSV(c echo.Context, code int, data interface{}) error {
+	b, err := MarshalCSV(data)
+	if err != nil {
+		return NewHTTPInternalError("Failed to render CSV").SetInternal(err)
+	}
+	return c.Blob(code, MIMETextCSV+"; charset=UTF-8", b)
+}
+
+// MarshalCSV encodes the slice of structs or maps as CSV. Struct fields are named by their json tags,
+// nested structs, slices and maps are encoded as JSON and times are formatted as RFC 3339.
+func MarshalCSV(data interface{}) ([]byte, error) {
+	v := reflect.ValueOf(data)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("csv: expecting slice, got %s", v.Kind())
+	}
+
+	var header []string
+	var rows [][]string
+	for i := 0; i < v.Len(); i++ {
+		item := reflect.Indirect(v.Index(i))
+		for item.Kind() == reflect.Interface || item.Kind() == reflect.Ptr {
+			item = reflect.Indirect(item.Elem())
+		}
+
+		var names []string
+		var values []reflect.Value
+		switch item.Kind() {
+		case reflect.Struct:
+			names, values = structFields(item)
+		case reflect.Map:
+			if item.Type().Key().Kind() != reflect.String {
+				return nil, fmt.Errorf("csv: expecting map with string keys, got %s", item.Type().Key().Kind())
+			}
+			// the columns of the first item are used for all items
+			names = header
+			if names == nil {
+				for _, k := range item.MapKeys() {
+					names = append(names, k.String())
+				}
+				sort.Strings(names)
+			}
+			for _, name := range names {
+				values = append(values, item.MapIndex(reflect.ValueOf(name).Convert(item.Type().Key())))
+			}
+		default:
+			return nil, fmt.Errorf("csv: expecting struct or map items, got %s", item.Kind())
+		}
+		if header == nil {
+			header = names
+		}
+
+		row := make([]string, len(values))
+		for j, val := range values {
+			cell, err := csvCell(val)
+			if err != nil {
+				return nil, err
+			}
+			row[j] = cell
+		}
+		rows = append(rows, row)
+	}
+
+	buf := new(bytes.Buffer)
+	w := csv.NewWriter(buf)
+	if header != nil {
+		if err := w.Write(header); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// structFields returns the json names and values of the exported fields, embedded structs are flattened
+func structFields(v reflect.Value) ([]string, []reflect.Value) {
+	var names []string
+	var values []reflect.Value
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		// the fields of embedded structs are promoted like encoding/json, even when the struct is unexported
+		if f.Anonymous && name == "" && reflect.Indirect(v.Field(i)).Kind() == reflect.Struct {
+			n, vals := structFields(reflect.Indirect(v.Field(i)))
+			names = append(names, n...)
+			values = append(values, vals...)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		names = append(names, name)
+		values = append(values, v.Field(i))
+	}
+	return names, values
+}
+
+// csvCell formats the value as a CSV cell
+func csvCell(v reflect.Value) (string, error) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return "", nil
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		if t.IsZero() {
+			return "", nil
+		}
+		return t.Format(time.RFC3339), nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return escapeFormula(v.String()), nil
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		b, err := json.Marshal(v.Interface())
+		if err != nil {
+			return "", err
+		}
+		return escapeFormula(string(b)), nil
+	default:
+		return fmt.Sprint(v.Interface()), nil
+	}
+}
+
+// escapeFormula prefixes the cells starting like a formula with a quote, so spreadsheets do not execute them
+func escapeFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/namhoai1109/tabi/core/logger"
+	"github.com/namhoai1109/tabi/core/middleware/logadapter"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
@@ -21,6 +22,19 @@ const (
 	ValidationErrorType = "VALIDATION"
 	// AuthorizationErrorType type of common errors
 	AuthorizationErrorType = "AUTHORIZATION"
+	// TimeoutErrorType type of common errors
+	TimeoutErrorType = "TIMEOUT"
+)
+
+// Error output formats
+const (
+	// ErrorFormatJSON renders errors as {"error":{...}}, this is the default format
+	ErrorFormatJSON = "json"
+	// ErrorFormatProblem renders errors as RFC 7807 problem details documents
+	ErrorFormatProblem = "problem"
+
+	// MIMEApplicationProblemJSON is the media type of RFC 7807 problem details documents
+	MIMEApplicationProblemJSON = "application/problem+json"
 )
 
 // ErrorResponse represents the error response
@@ -34,6 +48,48 @@ type HTTPError struct {
 	Type     string `json:"type"`
 	Message  string `json:"message"`
 	Internal error  `json:"-"`
+	// Extensions holds additional members rendered in problem details documents
+	Extensions map[string]interface{} `json:"-"`
+	// Key identifies the translated message registered by RegisterMessages
+	Key string `json:"-"`
+	// Params replace the {0}, {1}... placeholders of the translated message
+	Params []string `json:"-"`
+}
+
+// ProblemDetails represents the RFC 7807 problem details document
+type ProblemDetails struct {
+	Type     string
+	Title    string
+	Status   int
+	Detail   string
+	Instance string
+	// Extensions are rendered as top-level members next to the standard ones
+	Extensions map[string]interface{}
+}
+
+// MarshalJSON flattens extension members into the problem details document
+func (p *ProblemDetails) MarshalJSON() ([]byte, error) {
+	doc := make(map[string]interface{}, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		doc[k] = v
+	}
+	doc["type"] = p.Type
+	doc["title"] = p.Title
+	doc["status"] = p.Status
+	if p.Detail != "" {
+		doc["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		doc["instance"] = p.Instance
+	}
+	return json.Marshal(doc)
+}
+
+// ProblemFieldError represents a single validation failure in problem details documents
+type ProblemFieldError struct {
+	Field   string `json:"field"`
+	Tag     string `json:"tag"`
+	Message string `json:"message"`
 }
 
 // NewHTTPError creates a new HTTPError instance
@@ -56,6 +112,12 @@ func NewHTTPError(code int, etype string, message ...string) *HTTPError {
 	return he
 }
 
+// NewHTTPErrorWithKey creates a new HTTPError instance with message translated by key
+func NewHTTPErrorWithKey(code int, etype, key string, params ...string) *HTTPError {
+	he := NewHTTPError(code, etype)
+	return he.SetKey(key, params...)
+}
+
 // NewHTTPInternalError creates a new HTTPError instance for internal error
 func NewHTTPInternalError(message string) *HTTPError {
 	return &HTTPError{Code: http.StatusInternalServerError, Type: InternalErrorType, Message: message}
@@ -87,19 +149,59 @@ func (he *HTTPError) SetInternal(err error) *HTTPError {
 	return he
 }
 
+// SetKey sets the key of the translated message, the message in English is used as default
+func (he *HTTPError) SetKey(key string, params ...string) *HTTPError {
+	he.Key = key
+	he.Params = params
+	if msg, ok := Translate(LangEN, key, params...); ok {
+		he.Message = msg
+	}
+	return he
+}
+
+// SetExtension sets an extension member rendered in problem details documents
+func (he *HTTPError) SetExtension(key string, value interface{}) *HTTPError {
+	if he.Extensions == nil {
+		he.Extensions = make(map[string]interface{})
+	}
+	he.Extensions[key] = value
+	return he
+}
+
+// ErrorHandlerConfig represents the config of the error handler
+type ErrorHandlerConfig struct {
+	// Format is either ErrorFormatJSON (default) or ErrorFormatProblem.
+	// Clients sending `Accept: application/problem+json` always receive problem details documents.
+	Format string
+	// ProblemTypeURI is the base URI of problem types, e.g. https://api.tabi.vn/problems.
+	// The lowercased error type is appended to it. If empty, "about:blank" is used.
+	ProblemTypeURI string
+}
+
 // ErrorHandler represents the custom http error handler
 type ErrorHandler struct {
-	e *echo.Echo
+	e   *echo.Echo
+	cfg ErrorHandlerConfig
 }
 
 // NewErrorHandler returns the ErrorHandler instance
 func NewErrorHandler(e *echo.Echo) *ErrorHandler {
-	return &ErrorHandler{e}
+	return NewErrorHandlerWithConfig(e, ErrorHandlerConfig{})
+}
+
+// NewErrorHandlerWithConfig returns the ErrorHandler instance with custom config
+func NewErrorHandlerWithConfig(e *echo.Echo, cfg ErrorHandlerConfig) *ErrorHandler {
+	if cfg.Format == "" {
+		cfg.Format = ErrorFormatJSON
+	}
+	return &ErrorHandler{e: e, cfg: cfg}
 }
 
 // Handle is a centralized HTTP error handler.
 func (ce *ErrorHandler) Handle(err error, c echo.Context) {
 	httpErr := NewHTTPError(http.StatusInternalServerError, InternalErrorType)
+	var fieldErrors []ProblemFieldError
+	lang := RequestLanguage(c.Request())
 
 	switch e := err.(type) {
 	case *HTTPError:
@@ -114,6 +216,12 @@ func (ce *ErrorHandler) Handle(err error, c echo.Context) {
 		if e.Message != "" {
 			httpErr.Message = e.Message
 		}
+		if e.Key != "" {
+			if msg, ok := Translate(lang, e.Key, e.Params...); ok {
+				httpErr.Message = msg
+			}
+		}
+		httpErr.Extensions = e.Extensions
 		if e.Internal != nil && !c.Response().Committed {
 			logger.LogErrorWithEchoContext(c, fmt.Sprintf("internal err: %+v", e.Internal))
 		}
@@ -141,8 +249,14 @@ func (ce *ErrorHandler) Handle(err error, c echo.Context) {
 		httpErr.Code = http.StatusBadRequest
 		httpErr.Type = ValidationErrorType
 		var errMsg []string
+		cv, _ := ce.e.Validator.(*CustomValidator)
 		for _, v := range e {
-			errMsg = append(errMsg, getVldErrorMsg(v))
+			msg := getVldErrorMsg(v)
+			if cv != nil {
+				msg = cv.TranslateError(v, lang)
+			}
+			errMsg = append(errMsg, msg)
+			fieldErrors = append(fieldErrors, ProblemFieldError{Field: v.Field(), Tag: v.ActualTag(), Message: msg})
 		}
 		httpErr.Message = strings.Join(errMsg, "\n")
 	default:
@@ -155,6 +269,15 @@ func (ce *ErrorHandler) Handle(err error, c echo.Context) {
 	if !c.Response().Committed {
 		if c.Request().Method == http.MethodHead {
 			err = c.NoContent(httpErr.Code)
+		} else if ce.wantsProblem(c) {
+			problem := ce.newProblem(c, httpErr)
+			if fieldErrors != nil {
+				problem.Extensions["errors"] = fieldErrors
+			}
+			var b []byte
+			if b, err = json.Marshal(problem); err == nil {
+				err = c.Blob(httpErr.Code, MIMEApplicationProblemJSON, b)
+			}
 		} else {
 			err = c.JSON(httpErr.Code, ErrorResponse{Error: httpErr})
 		}
@@ -164,6 +287,36 @@ func (ce *ErrorHandler) Handle(err error, c echo.Context) {
 	}
 }
 
+// wantsProblem reports whether the error should be rendered as problem details document
+func (ce *ErrorHandler) wantsProblem(c echo.Context) bool {
+	if ce.cfg.Format == ErrorFormatProblem {
+		return true
+	}
+	return strings.Contains(c.Request().Header.Get(echo.HeaderAccept), MIMEApplicationProblemJSON)
+}
+
+// newProblem converts the HTTPError into problem details document
+func (ce *ErrorHandler) newProblem(c echo.Context, he *HTTPError) *ProblemDetails {
+	problem := &ProblemDetails{
+		Type:       "about:blank",
+		Title:      http.StatusText(he.Code),
+		Status:     he.Code,
+		Detail:     he.Message,
+		Instance:   c.Response().Header().Get(string(logadapter.RequestIDKey)),
+		Extensions: map[string]interface{}{"error_type": he.Type},
+	}
+	if ce.cfg.ProblemTypeURI != "" {
+		problem.Type = strings.TrimRight(ce.cfg.ProblemTypeURI, "/") + "/" + strings.ToLower(strings.ReplaceAll(he.Type, "_", "-"))
+	}
+	if problem.Instance == "" {
+		problem.Instance = c.Request().Header.Get(string(logadapter.RequestIDKey))
+	}
+	for k, v := range he.Extensions {
+		problem.Extensions[k] = v
+	}
+	return problem
+}
+
 var validationErrors = map[string]string{
 	"required": " is required, but was not received",
 	"min":      "'s value or length is less than allowed",
@@ -192,6 +345,9 @@ func getVldErrorMsg(v validator.FieldError) string {
 		return field + " should be greater than " + vtagVal
 	case "eqfield":
 		return field + " does not match " + vtagVal
+	case "password":
+		key, param := passwordRule(v)
+		return strings.NewReplacer("{0}", field, "{1}", param).Replace(passwordTranslations[LangEN][key])
 	}
 
 	return field + " failed on " + vtag + " validation"
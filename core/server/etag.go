@@ -0,0 +1,213 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// Conditional request headers
+const (
+	HeaderETag            = "ETag"
+	HeaderIfMatch         = "If-Match"
+	HeaderIfNoneMatch     = "If-None-Match"
+	HeaderIfModifiedSince = "If-Modified-Since"
+)
+
+// ETagConfig represents the config of the ETag middleware
+type ETagConfig struct {
+	Skipper middleware.Skipper
+}
+
+// ETag returns a middleware which computes weak ETags from the response bodies of GET requests
+// and responds 304 when the If-None-Match header matches
+func ETag() echo.MiddlewareFunc {
+	return ETagWithConfig(ETagConfig{})
+}
+
+// ETagWithConfig returns the ETag middleware with config.
+// The response body is buffered, so it should not be used for large downloads or streams.
+// Handlers setting the ETag header themselves, e.g. from the updated_at of the model, are not buffered.
+func ETagWithConfig(cfg ETagConfig) echo.MiddlewareFunc {
+	if cfg.Skipper == nil {
+		cfg.Skipper = middleware.DefaultSkipper
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if cfg.Skipper(c) || (req.Method != http.MethodGet && req.Method != http.MethodHead) {
+				return next(c)
+			}
+
+			res := c.Response()
+			writer := &etagWriter{ResponseWriter: res.Writer, code: http.StatusOK}
+			res.Writer = writer
+			err := next(c)
+			res.Writer = writer.ResponseWriter
+			if !writer.buffering {
+				return err
+			}
+
+			if err == nil && writer.code == http.StatusOK && res.Header().Get(HeaderETag) == "" {
+				etag := newETag(writer.body.Bytes())
+				res.Header().Set(HeaderETag, etag)
+				if etagMatch(req.Header.Get(HeaderIfNoneMatch), etag) {
+					res.Header().Del(echo.HeaderContentType)
+					res.Header().Del(echo.HeaderContentLength)
+					res.Status = http.StatusNotModified
+					writer.ResponseWriter.WriteHeader(http.StatusNotModified)
+					return nil
+				}
+			}
+			writer.ResponseWriter.WriteHeader(writer.code)
+			if _, werr := writer.ResponseWriter.Write(writer.body.Bytes()); werr != nil && err == nil {
+				err = werr
+			}
+			return err
+		}
+	}
+}
+
+// etagWriter buffers the response of the handler unless the handler sets the ETag header itself
+type etagWriter struct {
+	http.ResponseWriter
+	body      bytes.Buffer
+	code      int
+	buffering bool
+	decided   bool
+}
+
+func (w *etagWriter) WriteHeader(code int) {
+	if !w.decided {
+		w.decided = true
+		w.buffering = w.Header().Get(HeaderETag) == ""
+	}
+	if !w.buffering {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.code = code
+}
+
+func (w *etagWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.buffering {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.body.Write(b)
+}
+
+// NewWeakETag computes a weak ETag from the values identifying a version of the resource,
+// e.g. server.NewWeakETag(hotel.ID, hotel.UpdatedAt) or server.NewWeakETag(hotel.ID, hotel.Version)
+func NewWeakETag(values ...interface{}) string {
+	return "W/" + NewETag(values...)
+}
+
+// NewETag computes a strong ETag from the values identifying a version of the resource,
+// to be checked by CheckPrecondition, e.g. server.NewETag(hotel.ID, hotel.Version)
+func NewETag(values ...interface{}) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		if t, ok := v.(time.Time); ok {
+			v = t.UTC().UnixNano()
+		}
+		parts[i] = fmt.Sprintf("%v", v)
+	}
+	return strongETag([]byte(strings.Join(parts, ":")))
+}
+
+func newETag(b []byte) string {
+	return "W/" + strongETag(b)
+}
+
+func strongETag(b []byte) string {
+	sum := sha1.Sum(b)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// NotModified sets the ETag and Last-Modified headers and reports whether the conditional GET
+// is not modified, so the handler can respond 304. Empty etag or zero lastModified are not set.
+// If-None-Match takes precedence over If-Modified-Since. E.g:
+//
+//	if server.NotModified(c, server.NewWeakETag(hotel.ID, hotel.UpdatedAt), hotel.UpdatedAt) {
+//		return c.NoContent(http.StatusNotModified)
+//	}
+func NotModified(c echo.Context, etag string, lastModified time.Time) bool {
+	req := c.Request()
+	if etag != "" {
+		c.Response().Header().Set(HeaderETag, etag)
+	}
+	if !lastModified.IsZero() {
+		c.Response().Header().Set(echo.HeaderLastModified, lastModified.UTC().Format(http.TimeFormat))
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+
+	if inm := req.Header.Get(HeaderIfNoneMatch); inm != "" {
+		return etag != "" && etagMatch(inm, etag)
+	}
+	if ims := req.Header.Get(HeaderIfModifiedSince); ims != "" && !lastModified.IsZero() {
+		if t, err := http.ParseTime(ims); err == nil {
+			return !lastModified.Truncate(time.Second).After(t)
+		}
+	}
+	return false
+}
+
+// CheckPrecondition returns 412 error when the If-Match header of the request does not match
+// the current ETag of the resource, i.e. the resource was modified since the client fetched it.
+// Requests without If-Match header are allowed. If-Match uses strong comparison (RFC 9110 section 13.1.1),
+// so the resource must be served with a strong ETag. E.g. on PATCH/PUT:
+//
+//	if err := server.CheckPrecondition(c, server.NewETag(hotel.ID, hotel.UpdatedAt)); err != nil {
+//		return err
+//	}
+func CheckPrecondition(c echo.Context, etag string) error {
+	im := c.Request().Header.Get(HeaderIfMatch)
+	if im == "" || etagStrongMatch(im, etag) {
+		return nil
+	}
+	return NewHTTPError(http.StatusPreconditionFailed, GenericErrorType, "The resource has been modified, please reload and try again")
+}
+
+// etagMatch reports whether the header, a list of ETags or "*", matches the ETag using weak comparison
+func etagMatch(header, etag string) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// etagStrongMatch reports whether the header, a list of ETags or "*", matches the ETag using strong comparison,
+// the weak ETags never match
+func etagStrongMatch(header, etag string) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	if strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimSpace(tag) == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,300 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/namhoai1109/tabi/core/logger"
+	"github.com/namhoai1109/tabi/core/middleware/logadapter"
+	"github.com/namhoai1109/tabi/core/sqs"
+	"github.com/namhoai1109/tabi/core/tracing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+
+	echoadapter "github.com/awslabs/aws-lambda-go-api-proxy/echo"
+)
+
+// Event sources and types detected by EventRouter
+const (
+	EventSourceSQS = "aws:sqs"
+	EventSourceSNS = "aws:sns"
+
+	// EventTypeScheduled is the detail-type of EventBridge schedule events
+	EventTypeScheduled = "Scheduled Event"
+	// EventRouteAny matches any queue, topic or detail-type without its own handler
+	EventRouteAny = "*"
+)
+
+type (
+	// SQSHandler handles a single SQS record, returning error reports the record as batch item failure
+	SQSHandler func(ctx context.Context, record events.SQSMessage) error
+	// SNSHandler handles a single SNS record
+	SNSHandler func(ctx context.Context, record events.SNSEventRecord) error
+	// EventBridgeHandler handles EventBridge events, including schedules
+	EventBridgeHandler func(ctx context.Context, event events.CloudWatchEvent) error
+)
+
+// EventRouter detects the Lambda event type and dispatches it to the registered handlers
+type EventRouter struct {
+	sqs         map[string]SQSHandler
+	sns         map[string]SNSHandler
+	eventBridge map[string]EventBridgeHandler
+	e           *echo.Echo
+	v1          *echoadapter.EchoLambda
+	v2          *echoadapter.EchoLambdaV2
+	alb         *echoadapter.EchoLambdaALB
+}
+
+// NewEventRouter creates new event router
+func NewEventRouter() *EventRouter {
+	return &EventRouter{
+		sqs:         make(map[string]SQSHandler),
+		sns:         make(map[string]SNSHandler),
+		eventBridge: make(map[string]EventBridgeHandler),
+	}
+}
+
+// SQS registers handler for records of the queue name, or EventRouteAny.
+// Note: the event source mapping must enable ReportBatchItemFailures so only failed records are retried.
+func (r *EventRouter) SQS(queue string, h SQSHandler) *EventRouter {
+	r.sqs[queue] = h
+	return r
+}
+
+// SNS registers handler for records of the topic name, or EventRouteAny
+func (r *EventRouter) SNS(topic string, h SNSHandler) *EventRouter {
+	r.sns[topic] = h
+	return r
+}
+
+// EventBridge registers handler for events of the detail-type, or EventRouteAny
+func (r *EventRouter) EventBridge(detailType string, h EventBridgeHandler) *EventRouter {
+	r.eventBridge[detailType] = h
+	return r
+}
+
+// Schedule registers handler for EventBridge schedule events
+func (r *EventRouter) Schedule(h EventBridgeHandler) *EventRouter {
+	return r.EventBridge(EventTypeScheduled, h)
+}
+
+// HTTP forwards API Gateway (REST & HTTP API), Function URL and ALB events to the echo server
+func (r *EventRouter) HTTP(e *echo.Echo) *EventRouter {
+	r.e = e
+	r.v1 = echoadapter.New(e)
+	r.v2 = echoadapter.NewV2(e)
+	r.alb = echoadapter.NewALB(e)
+	return r
+}
+
+// HandleSQSMessage registers typed handler for records of the queue name, or EventRouteAny.
+// The body is decoded into T, SNS notification envelopes are unwrapped.
+func HandleSQSMessage[T any](r *EventRouter, queue string, h func(ctx context.Context, msg T, record events.SQSMessage) error) *EventRouter {
+	return r.SQS(queue, func(ctx context.Context, record events.SQSMessage) error {
+		body := []byte(record.Body)
+		envelope := new(sqs.SQSMessageResponse)
+		if err := json.Unmarshal(body, envelope); err == nil && envelope.Type == "Notification" && envelope.Message != "" {
+			body = []byte(envelope.Message)
+		}
+
+		var msg T
+		if err := json.Unmarshal(body, &msg); err != nil {
+			return fmt.Errorf("failed to decode message %s with err: %v", record.MessageId, err)
+		}
+		return h(ctx, msg, record)
+	})
+}
+
+// Start starts Lambda with the router as handler
+func (r *EventRouter) Start() {
+	go shutdownOnSignal()
+	lambda.Start(r.Invoke)
+}
+
+// eventProbe holds the fields used to detect the event type
+type eventProbe struct {
+	Records []struct {
+		EventSource    string `json:"eventSource"`
+		SNSEventSource string `json:"EventSource"`
+	} `json:"Records"`
+	DetailType     string `json:"detail-type"`
+	Version        string `json:"version"`
+	HTTPMethod     string `json:"httpMethod"`
+	RequestContext struct {
+		ELB  json.RawMessage `json:"elb"`
+		HTTP json.RawMessage `json:"http"`
+	} `json:"requestContext"`
+}
+
+// Invoke detects the event type of the payload and dispatches it
+func (r *EventRouter) Invoke(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	probe := new(eventProbe)
+	if err := json.Unmarshal(payload, probe); err != nil {
+		return nil, fmt.Errorf("failed to decode event with err: %v", err)
+	}
+
+	switch {
+	case len(probe.Records) > 0 && probe.Records[0].EventSource == EventSourceSQS:
+		event := new(events.SQSEvent)
+		if err := json.Unmarshal(payload, event); err != nil {
+			return nil, err
+		}
+		return r.dispatchSQS(ctx, event), nil
+
+	case len(probe.Records) > 0 && probe.Records[0].SNSEventSource == EventSourceSNS:
+		event := new(events.SNSEvent)
+		if err := json.Unmarshal(payload, event); err != nil {
+			return nil, err
+		}
+		return nil, r.dispatchSNS(ctx, event)
+
+	case probe.DetailType != "":
+		event := new(events.CloudWatchEvent)
+		if err := json.Unmarshal(payload, event); err != nil {
+			return nil, err
+		}
+		return nil, r.dispatchEventBridge(ctx, event)
+
+	case r.e != nil && len(probe.RequestContext.ELB) > 0:
+		req := events.ALBTargetGroupRequest{}
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return nil, err
+		}
+		return r.alb.ProxyWithContext(ctx, req)
+
+	case r.e != nil && probe.HTTPMethod != "":
+		req := events.APIGatewayProxyRequest{}
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return nil, err
+		}
+		return r.v1.ProxyWithContext(ctx, req)
+
+	case r.e != nil && probe.Version == "2.0" && len(probe.RequestContext.HTTP) > 0:
+		req := events.APIGatewayV2HTTPRequest{}
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return nil, err
+		}
+		return r.v2.ProxyWithContext(ctx, req)
+	}
+
+	return nil, fmt.Errorf("unsupported event: %s", string(payload))
+}
+
+// dispatchSQS handles the records and reports the failed ones as batch item failures
+func (r *EventRouter) dispatchSQS(ctx context.Context, event *events.SQSEvent) events.SQSEventResponse {
+	resp := events.SQSEventResponse{BatchItemFailures: []events.SQSBatchItemFailure{}}
+	failed := false
+	for _, record := range event.Records {
+		queue := arnResource(record.EventSourceARN)
+		// FIFO queues must not process the records after a failed one to keep the order
+		if failed && strings.HasSuffix(queue, ".fifo") {
+			resp.BatchItemFailures = append(resp.BatchItemFailures, events.SQSBatchItemFailure{ItemIdentifier: record.MessageId})
+			continue
+		}
+
+		h, ok := r.sqs[queue]
+		if !ok {
+			h, ok = r.sqs[EventRouteAny]
+		}
+		recordCtx, span := tracing.Start(contextFromAttributes(ctx, record), queue+" process",
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(
+				semconv.MessagingSystem(sqs.MessagingSystem),
+				semconv.MessagingDestinationName(queue),
+				semconv.MessagingMessageID(record.MessageId),
+				semconv.MessagingOperationProcess,
+			),
+		)
+		var err error
+		if !ok {
+			err = fmt.Errorf("no handler registered for queue %s", queue)
+		} else {
+			err = safeCall(func() error { return h(recordCtx, record) })
+		}
+		if err != nil {
+			logger.LogError(recordCtx, fmt.Sprintf("failed to handle SQS message %s with err: %v", record.MessageId, err))
+			resp.BatchItemFailures = append(resp.BatchItemFailures, events.SQSBatchItemFailure{ItemIdentifier: record.MessageId})
+			failed = true
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+	return resp
+}
+
+// dispatchSNS handles the records, Lambda retries the whole event on error
+func (r *EventRouter) dispatchSNS(ctx context.Context, event *events.SNSEvent) error {
+	for _, record := range event.Records {
+		topic := arnResource(record.SNS.TopicArn)
+		h, ok := r.sns[topic]
+		if !ok {
+			h, ok = r.sns[EventRouteAny]
+		}
+		if !ok {
+			return fmt.Errorf("no handler registered for topic %s", topic)
+		}
+		if err := safeCall(func() error { return h(ctx, record) }); err != nil {
+			logger.LogError(ctx, fmt.Sprintf("failed to handle SNS message %s with err: %v", record.SNS.MessageID, err))
+			return err
+		}
+	}
+	return nil
+}
+
+// dispatchEventBridge handles the event, Lambda retries the event on error
+func (r *EventRouter) dispatchEventBridge(ctx context.Context, event *events.CloudWatchEvent) error {
+	h, ok := r.eventBridge[event.DetailType]
+	if !ok {
+		h, ok = r.eventBridge[EventRouteAny]
+	}
+	if !ok {
+		return fmt.Errorf("no handler registered for detail-type %s", event.DetailType)
+	}
+	if err := safeCall(func() error { return h(ctx, *event) }); err != nil {
+		logger.LogError(ctx, fmt.Sprintf("failed to handle EventBridge event %s with err: %v", event.ID, err))
+		return err
+	}
+	return nil
+}
+
+// contextFromAttributes returns a copy of the context holding the request ID, correlation ID and trace context of the message attributes
+func contextFromAttributes(ctx context.Context, record events.SQSMessage) context.Context {
+	carrier := make(map[string]string, len(record.MessageAttributes))
+	for key, attr := range record.MessageAttributes {
+		if attr.StringValue != nil {
+			carrier[key] = *attr.StringValue
+		}
+	}
+	ctx = tracing.Extract(ctx, carrier)
+
+	if attr, ok := record.MessageAttributes[string(logadapter.RequestIDKey)]; ok && attr.StringValue != nil {
+		ctx = logadapter.WithRequestID(ctx, *attr.StringValue)
+	}
+	if attr, ok := record.MessageAttributes[string(logadapter.CorrelationIDKey)]; ok && attr.StringValue != nil {
+		ctx = logadapter.WithCorrelationID(ctx, *attr.StringValue)
+	}
+	return ctx
+}
+
+// safeCall converts panics of the handler into errors, so one record cannot fail the whole batch
+func safeCall(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn()
+}
+
+// arnResource returns the resource name of the ARN, e.g. the queue name of arn:aws:sqs:region:account:queue
+func arnResource(arn string) string {
+	return arn[strings.LastIndex(arn, ":")+1:]
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/vi"
+	ut "github.com/go-playground/universal-translator"
+)
+
+// Supported languages of the message catalog
+const (
+	LangEN = "en"
+	LangVI = "vi"
+)
+
+// messages holds translated HTTPError messages registered by services
+var messages = newUniversalTranslator()
+
+// newUniversalTranslator creates the translator of supported languages, English is the fallback
+func newUniversalTranslator() *ut.UniversalTranslator {
+	return ut.New(en.New(), en.New(), vi.New())
+}
+
+// RegisterMessages registers translated messages by key for the given language.
+// Messages can contain {0}, {1}... placeholders which are replaced by the params of HTTPError.
+// It is not safe for concurrent use, so register messages on start up.
+func RegisterMessages(lang string, msgs map[string]string) error {
+	trans, found := messages.GetTranslator(lang)
+	if !found {
+		return fmt.Errorf("language %s is not supported", lang)
+	}
+	for key, text := range msgs {
+		if err := trans.Add(key, text, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Translate returns the message of the key in the given language, falling back to English
+func Translate(lang, key string, params ...string) (string, bool) {
+	trans, _ := messages.FindTranslator(lang)
+	if msg, err := trans.T(key, params...); err == nil {
+		return msg, true
+	}
+	if fallback := messages.GetFallback(); fallback != trans {
+		if msg, err := fallback.T(key, params...); err == nil {
+			return msg, true
+		}
+	}
+	return "", false
+}
+
+// RequestLanguage returns the best supported language for the Accept-Language header of the request
+func RequestLanguage(r *http.Request) string {
+	trans, _ := messages.FindTranslator(AcceptedLanguages(r)...)
+	return trans.Locale()
+}
+
+// AcceptedLanguages parses the Accept-Language header into locales ordered by preference.
+// E.g: "vi-VN,vi;q=0.9,en;q=0.8" returns [vi_vn vi en]
+func AcceptedLanguages(r *http.Request) []string {
+	header := r.Header.Get("Accept-Language")
+	if header == "" {
+		return nil
+	}
+
+	type language struct {
+		tag     string
+		quality float64
+	}
+	var langs []language
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" || tag == "*" {
+			continue
+		}
+		quality := 1.0
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			if v, err := strconv.ParseFloat(strings.TrimPrefix(params, "q="), 64); err == nil {
+				quality = v
+			}
+		}
+		langs = append(langs, language{tag: strings.ToLower(strings.ReplaceAll(tag, "-", "_")), quality: quality})
+	}
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].quality > langs[j].quality })
+
+	var locales []string
+	for _, l := range langs {
+		locales = append(locales, l.tag)
+		if base, _, ok := strings.Cut(l.tag, "_"); ok {
+			locales = append(locales, base)
+		}
+	}
+	return locales
+}
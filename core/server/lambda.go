@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/labstack/echo/v4"
+
+	echoadapter "github.com/awslabs/aws-lambda-go-api-proxy/echo"
+)
+
+var (
+	echoLambdaV2  *echoadapter.EchoLambdaV2
+	echoLambdaALB *echoadapter.EchoLambdaALB
+)
+
+// LambdaHandler initializes the echo adapter of the Lambda run mode and returns the matching handler
+func LambdaHandler(e *echo.Echo, runMode string) (interface{}, error) {
+	switch runMode {
+	case RunModeAPIGateway:
+		echoLambda = echoadapter.New(e)
+		return Handler, nil
+	case RunModeAPIGatewayV2:
+		echoLambdaV2 = echoadapter.NewV2(e)
+		return HandlerV2, nil
+	case RunModeFunctionURL:
+		echoLambdaV2 = echoadapter.NewV2(e)
+		return HandlerFunctionURL, nil
+	case RunModeALB:
+		echoLambdaALB = echoadapter.NewALB(e)
+		return HandlerALB, nil
+	}
+	return nil, fmt.Errorf("unsupported lambda run mode: %s", runMode)
+}
+
+// HandlerV2 function to handle request, response of API Gateway HTTP API (payload format 2.0) through Lambda
+func HandlerV2(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	return echoLambdaV2.ProxyWithContext(ctx, req)
+}
+
+// HandlerFunctionURL function to handle request, response of Lambda Function URLs through Lambda
+func HandlerFunctionURL(ctx context.Context, req events.LambdaFunctionURLRequest) (events.LambdaFunctionURLResponse, error) {
+	resp, err := echoLambdaV2.ProxyWithContext(ctx, toAPIGatewayV2Request(req))
+	if err != nil {
+		return events.LambdaFunctionURLResponse{StatusCode: resp.StatusCode}, err
+	}
+	return toFunctionURLResponse(resp), nil
+}
+
+// HandlerALB function to handle request, response of Application Load Balancer targets through Lambda
+func HandlerALB(ctx context.Context, req events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error) {
+	return echoLambdaALB.ProxyWithContext(ctx, req)
+}
+
+// toAPIGatewayV2Request converts Function URL request to API Gateway v2 request since both use payload format 2.0
+func toAPIGatewayV2Request(req events.LambdaFunctionURLRequest) events.APIGatewayV2HTTPRequest {
+	return events.APIGatewayV2HTTPRequest{
+		Version:               req.Version,
+		RouteKey:              "$default",
+		RawPath:               req.RawPath,
+		RawQueryString:        req.RawQueryString,
+		Cookies:               req.Cookies,
+		Headers:               req.Headers,
+		QueryStringParameters: req.QueryStringParameters,
+		Body:                  req.Body,
+		IsBase64Encoded:       req.IsBase64Encoded,
+		RequestContext: events.APIGatewayV2HTTPRequestContext{
+			RouteKey:     "$default",
+			AccountID:    req.RequestContext.AccountID,
+			RequestID:    req.RequestContext.RequestID,
+			APIID:        req.RequestContext.APIID,
+			DomainName:   req.RequestContext.DomainName,
+			DomainPrefix: req.RequestContext.DomainPrefix,
+			Time:         req.RequestContext.Time,
+			TimeEpoch:    req.RequestContext.TimeEpoch,
+			HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{
+				Method:    req.RequestContext.HTTP.Method,
+				Path:      req.RequestContext.HTTP.Path,
+				Protocol:  req.RequestContext.HTTP.Protocol,
+				SourceIP:  req.RequestContext.HTTP.SourceIP,
+				UserAgent: req.RequestContext.HTTP.UserAgent,
+			},
+		},
+	}
+}
+
+// toFunctionURLResponse converts API Gateway v2 response to Function URL response
+func toFunctionURLResponse(resp events.APIGatewayV2HTTPResponse) events.LambdaFunctionURLResponse {
+	headers := make(map[string]string, len(resp.Headers)+len(resp.MultiValueHeaders))
+	for key, values := range resp.MultiValueHeaders {
+		headers[key] = strings.Join(values, ",")
+	}
+	for key, value := range resp.Headers {
+		headers[key] = value
+	}
+	return events.LambdaFunctionURLResponse{
+		StatusCode:      resp.StatusCode,
+		Headers:         headers,
+		Body:            resp.Body,
+		IsBase64Encoded: resp.IsBase64Encoded,
+		Cookies:         resp.Cookies,
+	}
+}
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/labstack/echo/v4"
+)
+
+// echoed is the response of the test route, echoing what reached the handler
+type echoed struct {
+	ID     string `json:"id"`
+	Path   string `json:"path"`
+	Query  string `json:"query"`
+	Header string `json:"header"`
+	Body   string `json:"body"`
+}
+
+func newLambdaTestEcho() *echo.Echo {
+	e := echo.New()
+	e.POST("/v1/bookings/:id", func(c echo.Context) error {
+		body, err := io.ReadAll(c.Request().Body)
+		if err != nil {
+			return err
+		}
+		c.SetCookie(&http.Cookie{Name: "a", Value: "1"})
+		c.SetCookie(&http.Cookie{Name: "b", Value: "2"})
+		c.Response().Header().Add("X-Multi", "x")
+		c.Response().Header().Add("X-Multi", "y")
+		return c.JSON(http.StatusCreated, echoed{
+			ID:     c.Param("id"),
+			Path:   c.Request().URL.Path,
+			Query:  c.QueryParam("lang"),
+			Header: c.Request().Header.Get("X-Test"),
+			Body:   string(body),
+		})
+	})
+	return e
+}
+
+var wantEchoed = echoed{ID: "42", Path: "/v1/bookings/42", Query: "vi", Header: "hello", Body: `{"room":1}`}
+
+func lambdaHandler(t *testing.T, runMode string) interface{} {
+	t.Helper()
+	handler, err := LambdaHandler(newLambdaTestEcho(), runMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return handler
+}
+
+func decodeEvent(t *testing.T, data string, out interface{}) {
+	t.Helper()
+	if err := json.Unmarshal([]byte(data), out); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkEchoed(t *testing.T, status int, body string) {
+	t.Helper()
+	if status != http.StatusCreated {
+		t.Fatalf("status = %d, body = %s", status, body)
+	}
+	got := echoed{}
+	if err := json.Unmarshal([]byte(body), &got); err != nil {
+		t.Fatalf("invalid body %s: %v", body, err)
+	}
+	if got != wantEchoed {
+		t.Errorf("handler got %+v, want %+v", got, wantEchoed)
+	}
+}
+
+const apiGatewayEvent = `{
+	"resource": "/{proxy+}",
+	"path": "/v1/bookings/42",
+	"httpMethod": "POST",
+	"headers": {"Content-Type": "application/json", "X-Test": "hello", "Host": "api.tabi.vn"},
+	"multiValueHeaders": {"Content-Type": ["application/json"], "X-Test": ["hello"], "Host": ["api.tabi.vn"]},
+	"queryStringParameters": {"lang": "vi"},
+	"multiValueQueryStringParameters": {"lang": ["vi"]},
+	"pathParameters": {"proxy": "v1/bookings/42"},
+	"requestContext": {"resourcePath": "/{proxy+}", "httpMethod": "POST", "stage": "prod", "requestId": "req-1"},
+	"body": "{\"room\":1}",
+	"isBase64Encoded": false
+}`
+
+func TestLambdaAPIGateway(t *testing.T) {
+	handler, ok := lambdaHandler(t, RunModeAPIGateway).(func(context.Context, events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error))
+	if !ok {
+		t.Fatal("unexpected handler type")
+	}
+	req := events.APIGatewayProxyRequest{}
+	decodeEvent(t, apiGatewayEvent, &req)
+
+	resp, err := handler(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEchoed(t, resp.StatusCode, resp.Body)
+	if got := resp.MultiValueHeaders["Set-Cookie"]; len(got) != 2 {
+		t.Errorf("Set-Cookie = %v, want 2 cookies", got)
+	}
+	if got := resp.MultiValueHeaders["X-Multi"]; !reflect.DeepEqual(got, []string{"x", "y"}) {
+		t.Errorf("X-Multi = %v", got)
+	}
+}
+
+const apiGatewayV2Event = `{
+	"version": "2.0",
+	"routeKey": "$default",
+	"rawPath": "/v1/bookings/42",
+	"rawQueryString": "lang=vi",
+	"cookies": ["session=abc"],
+	"headers": {"content-type": "application/json", "x-test": "hello", "host": "api.tabi.vn"},
+	"queryStringParameters": {"lang": "vi"},
+	"requestContext": {
+		"routeKey": "$default",
+		"requestId": "req-2",
+		"domainName": "api.tabi.vn",
+		"http": {"method": "POST", "path": "/v1/bookings/42", "protocol": "HTTP/1.1", "sourceIp": "1.2.3.4", "userAgent": "test"}
+	},
+	"body": "{\"room\":1}",
+	"isBase64Encoded": false
+}`
+
+func TestLambdaAPIGatewayV2(t *testing.T) {
+	handler, ok := lambdaHandler(t, RunModeAPIGatewayV2).(func(context.Context, events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error))
+	if !ok {
+		t.Fatal("unexpected handler type")
+	}
+	req := events.APIGatewayV2HTTPRequest{}
+	decodeEvent(t, apiGatewayV2Event, &req)
+
+	resp, err := handler(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEchoed(t, resp.StatusCode, resp.Body)
+	if len(resp.Cookies) != 2 {
+		t.Errorf("cookies = %v, want 2 cookies", resp.Cookies)
+	}
+	if got := resp.Headers["X-Multi"]; got != "x,y" {
+		t.Errorf("X-Multi = %q", got)
+	}
+}
+
+const functionURLEvent = `{
+	"version": "2.0",
+	"rawPath": "/v1/bookings/42",
+	"rawQueryString": "lang=vi",
+	"headers": {"content-type": "application/json", "x-test": "hello", "host": "abc.lambda-url.ap-southeast-1.on.aws"},
+	"queryStringParameters": {"lang": "vi"},
+	"requestContext": {
+		"requestId": "req-3",
+		"domainName": "abc.lambda-url.ap-southeast-1.on.aws",
+		"http": {"method": "POST", "path": "/v1/bookings/42", "protocol": "HTTP/1.1", "sourceIp": "1.2.3.4", "userAgent": "test"}
+	},
+	"body": "eyJyb29tIjoxfQ==",
+	"isBase64Encoded": true
+}`
+
+func TestLambdaFunctionURL(t *testing.T) {
+	handler, ok := lambdaHandler(t, RunModeFunctionURL).(func(context.Context, events.LambdaFunctionURLRequest) (events.LambdaFunctionURLResponse, error))
+	if !ok {
+		t.Fatal("unexpected handler type")
+	}
+	req := events.LambdaFunctionURLRequest{}
+	decodeEvent(t, functionURLEvent, &req)
+
+	resp, err := handler(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEchoed(t, resp.StatusCode, resp.Body)
+	if len(resp.Cookies) != 2 {
+		t.Errorf("cookies = %v, want 2 cookies", resp.Cookies)
+	}
+	if got := resp.Headers["X-Multi"]; got != "x,y" {
+		t.Errorf("X-Multi = %q", got)
+	}
+}
+
+const albEvent = `{
+	"requestContext": {"elb": {"targetGroupArn": "arn:aws:elasticloadbalancing:ap-southeast-1:123:targetgroup/tabi/abc"}},
+	"httpMethod": "POST",
+	"path": "/v1/bookings/42",
+	"multiValueQueryStringParameters": {"lang": ["vi"]},
+	"multiValueHeaders": {"content-type": ["application/json"], "x-test": ["hello"], "host": ["api.tabi.vn"]},
+	"body": "{\"room\":1}",
+	"isBase64Encoded": false
+}`
+
+func TestLambdaALB(t *testing.T) {
+	handler, ok := lambdaHandler(t, RunModeALB).(func(context.Context, events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error))
+	if !ok {
+		t.Fatal("unexpected handler type")
+	}
+	req := events.ALBTargetGroupRequest{}
+	decodeEvent(t, albEvent, &req)
+
+	resp, err := handler(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEchoed(t, resp.StatusCode, resp.Body)
+	if got := resp.MultiValueHeaders["Set-Cookie"]; len(got) != 2 {
+		t.Errorf("Set-Cookie = %v, want 2 cookies", got)
+	}
+	if got := resp.MultiValueHeaders["X-Multi"]; !reflect.DeepEqual(got, []string{"x", "y"}) {
+		t.Errorf("X-Multi = %v", got)
+	}
+}
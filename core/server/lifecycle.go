@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/namhoai1109/tabi/core/logger"
+)
+
+// DefaultShutdownTimeout is the default deadline for executing all shutdown hooks
+const DefaultShutdownTimeout = 10 * time.Second
+
+// ShutdownHook is executed when the service is shutting down.
+// The context is canceled when the shutdown deadline is exceeded.
+type ShutdownHook func(ctx context.Context) error
+
+type namedHook struct {
+	name string
+	fn   ShutdownHook
+}
+
+// Lifecycle manages the shutdown hooks of the service
+type Lifecycle struct {
+	mu      sync.Mutex
+	hooks   []namedHook
+	timeout time.Duration
+	once    sync.Once
+	err     error
+}
+
+var lifecycle = NewLifecycle(DefaultShutdownTimeout)
+
+// NewLifecycle creates new lifecycle manager with the given shutdown deadline
+func NewLifecycle(timeout time.Duration) *Lifecycle {
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	return &Lifecycle{timeout: timeout}
+}
+
+// SetLifecycle sets the default lifecycle manager
+func SetLifecycle(l *Lifecycle) { lifecycle = l }
+
+// GetLifecycle returns the default lifecycle manager
+func GetLifecycle() *Lifecycle { return lifecycle }
+
+// OnShutdown registers a hook on the default lifecycle manager
+func OnShutdown(name string, hook ShutdownHook) { lifecycle.OnShutdown(name, hook) }
+
+// CloseFunc adapts a close function without result to ShutdownHook.
+// E.g: server.OnShutdown("purchase-log", server.CloseFunc(client.CloseLog))
+func CloseFunc(fn func()) ShutdownHook {
+	return func(ctx context.Context) error {
+		fn()
+		return nil
+	}
+}
+
+// CloserFunc adapts a close function returning error to ShutdownHook
+func CloserFunc(fn func() error) ShutdownHook {
+	return func(ctx context.Context) error {
+		return fn()
+	}
+}
+
+// SetTimeout sets the deadline for executing all shutdown hooks
+func (l *Lifecycle) SetTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.timeout = timeout
+}
+
+// Timeout returns the deadline for executing all shutdown hooks
+func (l *Lifecycle) Timeout() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.timeout
+}
+
+// OnShutdown registers a hook, hooks are executed in the order they are registered
+func (l *Lifecycle) OnShutdown(name string, hook ShutdownHook) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.hooks = append(l.hooks, namedHook{name: name, fn: hook})
+}
+
+// WaitForSignal blocks until SIGINT or SIGTERM is received
+func (l *Lifecycle) WaitForSignal() os.Signal {
+	quit := make(chan os.Signal, 1) // buffered channel
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(quit)
+	return <-quit
+}
+
+// ShutdownWithTimeout executes the shutdown hooks within the configured deadline
+func (l *Lifecycle) ShutdownWithTimeout() error {
+	ctx, cancel := context.WithTimeout(context.Background(), l.Timeout())
+	defer cancel()
+	return l.Shutdown(ctx)
+}
+
+// Shutdown executes the shutdown hooks in order. Hooks are executed only once,
+// the remaining ones are skipped when the context is done.
+func (l *Lifecycle) Shutdown(ctx context.Context) error {
+	l.once.Do(func() {
+		l.mu.Lock()
+		hooks := make([]namedHook, len(l.hooks))
+		copy(hooks, l.hooks)
+		l.mu.Unlock()
+
+		var errMsgs []string
+		for _, hook := range hooks {
+			if err := runHook(ctx, hook); err != nil {
+				logger.LogError(ctx, fmt.Sprintf("shutdown hook %s failed with err: %v", hook.name, err))
+				errMsgs = append(errMsgs, fmt.Sprintf("%s: %v", hook.name, err))
+				if ctx.Err() != nil {
+					break
+				}
+				continue
+			}
+			logger.LogInfo(ctx, fmt.Sprintf("shutdown hook %s completed", hook.name))
+		}
+		if len(errMsgs) > 0 {
+			l.err = fmt.Errorf("shutdown hooks failed: %s", strings.Join(errMsgs, "; "))
+		}
+	})
+	return l.err
+}
+
+// runHook executes the hook and gives up when the context is done
+func runHook(ctx context.Context, hook namedHook) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- hook.fn(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
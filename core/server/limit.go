@@ -0,0 +1,151 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	gbytes "github.com/labstack/gommon/bytes"
+)
+
+// TimeoutConfig represents the config of the request deadline middleware
+type TimeoutConfig struct {
+	// Timeout is the default request deadline, zero means no deadline
+	Timeout time.Duration
+	// Routes holds deadlines by route path, optionally prefixed by method.
+	// E.g: {"POST /v1/payments/:id/capture": 30 * time.Second, "/v1/reports": time.Minute}
+	Routes map[string]time.Duration
+	// ErrorCode is the status code responded when the deadline is exceeded, 504 by default
+	ErrorCode int
+}
+
+// Timeout returns a middleware which sets the request deadline, e.g. for a route group
+func Timeout(timeout time.Duration) echo.MiddlewareFunc {
+	return TimeoutWithConfig(TimeoutConfig{Timeout: timeout})
+}
+
+// TimeoutWithConfig returns a middleware which propagates the request deadline via the request context.
+// Handlers must pass the context to DB queries and outgoing calls so they are canceled on time.
+func TimeoutWithConfig(cfg TimeoutConfig) echo.MiddlewareFunc {
+	if cfg.ErrorCode == 0 {
+		cfg.ErrorCode = http.StatusGatewayTimeout
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			timeout := cfg.Timeout
+			if d, ok := cfg.Routes[c.Request().Method+" "+c.Path()]; ok {
+				timeout = d
+			} else if d, ok := cfg.Routes[c.Path()]; ok {
+				timeout = d
+			}
+			if timeout <= 0 {
+				return next(c)
+			}
+
+			ctx, cancel := context.WithTimeout(c.Request().Context(), timeout)
+			defer cancel()
+			c.SetRequest(c.Request().WithContext(ctx))
+
+			// the error is rendered here, so the middlewares rendering the handler errors themselves,
+			// e.g. BodyDump, do not commit the context error first
+			err := next(c)
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) && !c.Response().Committed {
+				he := NewHTTPError(cfg.ErrorCode, TimeoutErrorType, "The request took too long to process")
+				if err != nil {
+					he.SetInternal(err)
+				}
+				c.Error(he)
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// BodyLimitConfig represents the config of the body limit middleware
+type BodyLimitConfig struct {
+	// Limit is the default max body size, e.g. "2M". Empty means no limit
+	Limit string
+	// Groups holds max body sizes by path prefix, the longest prefix wins.
+	// E.g: {"/v1/documents": "20M"} for multipart uploads
+	Groups map[string]string
+}
+
+// BodyLimit returns a middleware which limits the request body size, e.g. "2M".
+// Note: it cannot raise the limit set by a middleware running before it, use BodyLimitConfig.Groups instead.
+func BodyLimit(limit string) echo.MiddlewareFunc {
+	return BodyLimitWithConfig(BodyLimitConfig{Limit: limit})
+}
+
+// BodyLimitWithConfig returns a middleware which limits the request body size by path prefix
+func BodyLimitWithConfig(cfg BodyLimitConfig) echo.MiddlewareFunc {
+	limit := parseBodyLimit(cfg.Limit)
+	groups := make(map[string]int64, len(cfg.Groups))
+	for prefix, l := range cfg.Groups {
+		groups[prefix] = parseBodyLimit(l)
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			max, matched := limit, ""
+			for prefix, l := range groups {
+				if strings.HasPrefix(req.URL.Path, prefix) && len(prefix) > len(matched) {
+					max, matched = l, prefix
+				}
+			}
+			if max <= 0 || req.Body == nil {
+				return next(c)
+			}
+
+			// the error is rendered here like in Timeout, so the metrics and tracing middlewares see the status
+			tooLarge := NewHTTPError(http.StatusRequestEntityTooLarge, GenericErrorType,
+				fmt.Sprintf("The request body must not be larger than %s", gbytes.Format(max)))
+			if req.ContentLength > max {
+				c.Error(tooLarge)
+				return nil
+			}
+			if req.ContentLength < 0 {
+				// the chunked body is read up to the limit here, so the middlewares reading the whole body,
+				// e.g. BodyDump, never buffer more than the limit
+				body, err := io.ReadAll(io.LimitReader(req.Body, max+1))
+				if err != nil {
+					return err
+				}
+				if int64(len(body)) > max {
+					c.Error(tooLarge)
+					return nil
+				}
+				req.Body = io.NopCloser(bytes.NewReader(body))
+			} else {
+				req.Body = http.MaxBytesReader(c.Response(), req.Body, max)
+			}
+
+			err := next(c)
+			var maxBytesErr *http.MaxBytesError
+			if err != nil && errors.As(err, &maxBytesErr) && !c.Response().Committed {
+				c.Error(tooLarge.SetInternal(err))
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func parseBodyLimit(limit string) int64 {
+	if limit == "" {
+		return 0
+	}
+	l, err := gbytes.Parse(limit)
+	if err != nil {
+		panic(fmt.Sprintf("invalid body limit %s: %v", limit, err))
+	}
+	return l
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TestBodyLimitMetrics checks the oversized bodies are recorded with their final status by the outer middlewares
+func TestBodyLimitMetrics(t *testing.T) {
+	e := New(&Config{BodyLimit: "1K", MetricsPath: "/metrics", MetricsToken: "secret"}, false)
+	e.POST("/v1/uploads", func(c echo.Context) error {
+		if _, err := io.ReadAll(c.Request().Body); err != nil {
+			return err
+		}
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	body := strings.Repeat("a", 2048)
+	fixed := httptest.NewRequest(http.MethodPost, "/v1/uploads", strings.NewReader(body))
+	chunked := httptest.NewRequest(http.MethodPost, "/v1/uploads", io.NopCloser(strings.NewReader(body)))
+	chunked.ContentLength = -1
+	for _, req := range []*http.Request{fixed, chunked} {
+		res := httptest.NewRecorder()
+		e.ServeHTTP(res, req)
+		if res.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("status = %d, body = %s", res.Code, res.Body)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer secret")
+	res := httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+	want := `tabi_http_requests_total{method="POST",route="/v1/uploads",status="413"} 2`
+	if !strings.Contains(res.Body.String(), want) {
+		t.Errorf("metrics do not contain %s", want)
+	}
+}
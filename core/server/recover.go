@@ -0,0 +1,82 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/namhoai1109/tabi/core/middleware/logadapter"
+
+	"github.com/labstack/echo/v4"
+)
+
+// PanicHook is called with every recovered panic, e.g. to forward it to an error tracker
+type PanicHook func(c echo.Context, err error, stack []logadapter.StackFrame)
+
+// RecoverConfig represents the config of the recover middleware
+type RecoverConfig struct {
+	// StackSize is the max number of stack frames to be logged
+	StackSize int
+	// Hook is called after the panic is logged
+	Hook PanicHook
+}
+
+// DefaultRecoverConfig is the default config of the recover middleware
+var DefaultRecoverConfig = RecoverConfig{
+	StackSize: 32,
+}
+
+// Recover returns a middleware which recovers from panics with default config
+func Recover() echo.MiddlewareFunc {
+	return RecoverWithConfig(DefaultRecoverConfig)
+}
+
+// RecoverWithConfig returns a middleware which recovers from panics, logs them with the stack trace
+// and the request context, then responds with an internal HTTPError before returning to the outer middlewares
+func RecoverWithConfig(cfg RecoverConfig) echo.MiddlewareFunc {
+	if cfg.StackSize == 0 {
+		cfg.StackSize = DefaultRecoverConfig.StackSize
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (returnErr error) {
+			defer func() {
+				r := recover()
+				if r == nil {
+					return
+				}
+				if r == http.ErrAbortHandler {
+					panic(r)
+				}
+				err, ok := r.(error)
+				if !ok {
+					err = fmt.Errorf("%v", r)
+				}
+
+				// skip this function and runtime.gopanic
+				stack := logadapter.GetStack(2, cfg.StackSize)
+				req := c.Request()
+				fields := map[string]interface{}{
+					"method": req.Method,
+					"url":    req.URL.Path,
+					"panic":  err.Error(),
+					"stack":  stack,
+				}
+				if requestID := req.Header.Get(string(logadapter.RequestIDKey)); requestID != "" {
+					fields["request_id"] = requestID
+				}
+				if info := req.Context().Value(logadapter.UserInfoKey); info != nil {
+					fields["user_info"] = info
+				}
+				logadapter.LogWithEchoContext(c, fmt.Sprintf("[PANIC RECOVER] %v", err), logadapter.LogTypeError, fields)
+
+				if cfg.Hook != nil {
+					cfg.Hook(c, err, stack)
+				}
+				// the error is rendered here, so the outer middlewares, e.g. metrics and tracing, read the 500 status
+				c.Error(NewHTTPInternalError(http.StatusText(http.StatusInternalServerError)).SetInternal(err))
+				returnErr = nil
+			}()
+			return next(c)
+		}
+	}
+}
@@ -2,40 +2,90 @@ package server
 
 import (
 	"context"
+	"crypto/subtle"
 	"fmt"
 	"net/http"
 	"os"
-	"os/signal"
 	"time"
 
+	"github.com/namhoai1109/tabi/core/logger"
+	"github.com/namhoai1109/tabi/core/metrics"
 	"github.com/namhoai1109/tabi/core/middleware/logadapter"
 	"github.com/namhoai1109/tabi/core/middleware/secure"
+	"github.com/namhoai1109/tabi/core/tracing"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
 	"github.com/labstack/gommon/log"
 
 	echoadapter "github.com/awslabs/aws-lambda-go-api-proxy/echo"
 )
 
+// Run modes of the server
+const (
+	// RunModeHTTP runs plain HTTP server, e.g. for local development, ECS or containers
+	RunModeHTTP = "http"
+	// RunModeAPIGateway runs on Lambda behind API Gateway REST API (payload format 1.0)
+	RunModeAPIGateway = "apigateway"
+	// RunModeAPIGatewayV2 runs on Lambda behind API Gateway HTTP API (payload format 2.0)
+	RunModeAPIGatewayV2 = "apigateway-v2"
+	// RunModeFunctionURL runs on Lambda behind Lambda Function URLs
+	RunModeFunctionURL = "function-url"
+	// RunModeALB runs on Lambda as target of Application Load Balancer
+	RunModeALB = "alb"
+)
+
 // Config represents server specific config
 type Config struct {
-	Stage        string
+	Stage string
+	// RunMode is one of the RunMode* constants. If empty, development stage runs
+	// plain HTTP server and other stages run on Lambda behind API Gateway REST API
+	RunMode      string
 	Port         int
 	ReadTimeout  int
 	WriteTimeout int
 	AllowOrigins []string
+	// ErrorFormat is either "json" (default) or "problem" for RFC 7807 documents
+	ErrorFormat string
+	// ProblemTypeURI is the base URI of problem types in RFC 7807 documents
+	ProblemTypeURI string
+	// PanicHook forwards recovered panics, e.g. to an error tracker
+	PanicHook PanicHook
+	// ShutdownTimeout is the deadline (in seconds) for gracefully shutting down the server, then for executing shutdown hooks
+	ShutdownTimeout int
+	// RequestTimeout is the default request deadline (in seconds), zero means no deadline
+	RequestTimeout int
+	// RouteTimeouts holds request deadlines (in seconds) by route path, optionally prefixed by method
+	RouteTimeouts map[string]int
+	// TimeoutErrorCode is either 503 or 504 (default) when the request deadline is exceeded
+	TimeoutErrorCode int
+	// BodyLimit is the default max request body size, e.g. "2M". Empty means no limit
+	BodyLimit string
+	// BodyLimits holds max request body sizes by path prefix, e.g. {"/v1/documents": "20M"}
+	BodyLimits map[string]string
+	// MetricsPath exposes the Prometheus metrics on the path, e.g. "/metrics". Empty means not exposed.
+	// Either MetricsAuth or MetricsToken is required as the path is served by the public router.
+	MetricsPath string
+	// MetricsAuth protects the metrics endpoint, e.g. middleware.BasicAuth or an IP allow list
+	MetricsAuth echo.MiddlewareFunc
+	// MetricsToken is the bearer token of the metrics endpoint when MetricsAuth is not set
+	MetricsToken string
+	// Compress enables br/gzip/deflate compression of the responses.
+	// It is skipped when running behind API Gateway, which compresses the responses itself.
+	Compress bool
+	// CompressMinLength is the min response size (in bytes) to be compressed, default is 1024
+	CompressMinLength int
 }
 
 // DefaultConfig for the API server
 var DefaultConfig = Config{
-	Stage:        "development",
-	Port:         3000,
-	ReadTimeout:  10,
-	WriteTimeout: 5,
-	AllowOrigins: []string{"*"},
+	Stage:           "development",
+	Port:            3000,
+	ReadTimeout:     10,
+	WriteTimeout:    5,
+	AllowOrigins:    []string{"*"},
+	ShutdownTimeout: 10,
 }
 
 var echoLambda *echoadapter.EchoLambda
@@ -44,6 +94,13 @@ func (c *Config) fillDefaults() {
 	if c.Stage == "" {
 		c.Stage = DefaultConfig.Stage
 	}
+	if c.RunMode == "" {
+		if c.Stage == DefaultConfig.Stage {
+			c.RunMode = RunModeHTTP
+		} else {
+			c.RunMode = RunModeAPIGateway
+		}
+	}
 	if c.Port == 0 {
 		c.Port = DefaultConfig.Port
 	}
@@ -56,64 +113,146 @@ func (c *Config) fillDefaults() {
 	if c.AllowOrigins == nil && len(c.AllowOrigins) == 0 {
 		c.AllowOrigins = DefaultConfig.AllowOrigins
 	}
+	if c.ShutdownTimeout == 0 {
+		c.ShutdownTimeout = DefaultConfig.ShutdownTimeout
+	}
 }
 
 // New instance new Echo server
 func New(cfg *Config, isReqLog bool) *echo.Echo {
 	cfg.fillDefaults()
+	if cfg.TimeoutErrorCode != 0 && cfg.TimeoutErrorCode != http.StatusServiceUnavailable && cfg.TimeoutErrorCode != http.StatusGatewayTimeout {
+		panic(fmt.Sprintf("invalid timeout error code %d, must be 503 or 504", cfg.TimeoutErrorCode))
+	}
 	e := echo.New()
 
+	e.Use(logadapter.NewRequestIDMiddleware(), tracing.Middleware(), metrics.Middleware())
+	if cfg.MetricsPath != "" {
+		auth := cfg.MetricsAuth
+		if auth == nil {
+			auth = metricsTokenAuth(cfg.MetricsToken)
+		}
+		e.GET(cfg.MetricsPath, metrics.Handler(), auth)
+	}
 	if isReqLog {
 		e.Use(logadapter.NewEchoLoggerMiddleware())
 		e.Logger = logadapter.NewEchoLogger()
 	}
-	e.Use(middleware.RecoverWithConfig(middleware.RecoverConfig{LogLevel: log.ERROR}),
+	e.Use(RecoverWithConfig(RecoverConfig{Hook: cfg.PanicHook}),
 		secure.Headers(), secure.CORS(&secure.Config{AllowOrigins: cfg.AllowOrigins}))
 	e.Validator = NewValidator()
-	e.HTTPErrorHandler = NewErrorHandler(e).Handle
+	e.HTTPErrorHandler = NewErrorHandlerWithConfig(e, ErrorHandlerConfig{
+		Format:         cfg.ErrorFormat,
+		ProblemTypeURI: cfg.ProblemTypeURI,
+	}).Handle
 	e.Binder = NewBinder()
+	// the body limit runs before BodyDump and Compress, so the oversized bodies are never buffered
+	e.Use(BodyLimitWithConfig(BodyLimitConfig{Limit: cfg.BodyLimit, Groups: cfg.BodyLimits}))
+	if cfg.Compress && cfg.RunMode != RunModeAPIGateway && cfg.RunMode != RunModeAPIGatewayV2 {
+		e.Use(CompressWithConfig(CompressConfig{MinLength: cfg.CompressMinLength}))
+	}
 	e.Use(secure.BodyDump())
+	routeTimeouts := make(map[string]time.Duration, len(cfg.RouteTimeouts))
+	for route, timeout := range cfg.RouteTimeouts {
+		routeTimeouts[route] = time.Duration(timeout) * time.Second
+	}
+	e.Use(TimeoutWithConfig(TimeoutConfig{
+		Timeout:   time.Duration(cfg.RequestTimeout) * time.Second,
+		Routes:    routeTimeouts,
+		ErrorCode: cfg.TimeoutErrorCode,
+	}))
 	e.Logger.SetLevel(log.DEBUG)
 	logadapter.SetLevel(logadapter.DebugLevel)
 
 	e.Server.Addr = fmt.Sprintf(":%d", cfg.Port)
 	e.Server.ReadTimeout = time.Duration(cfg.ReadTimeout) * time.Minute
 	e.Server.WriteTimeout = time.Duration(cfg.WriteTimeout) * time.Minute
+	lifecycle.SetTimeout(time.Duration(cfg.ShutdownTimeout) * time.Second)
 	return e
 }
 
+// metricsTokenAuth returns a middleware which requires the bearer token, it panics with empty token
+func metricsTokenAuth(token string) echo.MiddlewareFunc {
+	if token == "" {
+		panic("metrics endpoint requires MetricsAuth or MetricsToken")
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			auth := c.Request().Header.Get(echo.HeaderAuthorization)
+			if subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+token)) != 1 {
+				return NewHTTPAuthorizationError("Your session is unauthorized or has expired.")
+			}
+			return next(c)
+		}
+	}
+}
+
 // Start starts echo server
 func Start(e *echo.Echo, isDevelopment bool) {
 	// graceful shutdown for dev environment
 	if isDevelopment {
-		// Start server
-		go func() {
-			if err := e.StartServer(e.Server); err != nil {
-				if err == http.ErrServerClosed {
-					fmt.Println("shutting down the server")
-				} else {
-					fmt.Errorf("error shutting down the server: %v", err)
-				}
-			}
-		}()
-
-		// Wait for interrupt signal to gracefully shutdown the server with
-		// a timeout of 10 seconds.
-		quit := make(chan os.Signal, 1) // buffered channel
-		signal.Notify(quit, os.Interrupt)
-		<-quit
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-		if err := e.Shutdown(ctx); err != nil {
-			e.Logger.Fatal(err)
-		}
+		StartServer(e)
 	} else {
 		// User echo adapter for Lambda
 		echoLambda = echoadapter.New(e)
+		go shutdownOnSignal()
 		lambda.Start(Handler)
 	}
 }
 
+// StartWithConfig starts echo server in the run mode of the config
+func StartWithConfig(e *echo.Echo, cfg *Config) error {
+	cfg.fillDefaults()
+	if cfg.RunMode == RunModeHTTP {
+		StartServer(e)
+		return nil
+	}
+
+	handler, err := LambdaHandler(e, cfg.RunMode)
+	if err != nil {
+		return err
+	}
+	go shutdownOnSignal()
+	lambda.Start(handler)
+	return nil
+}
+
+// StartServer starts echo server and waits for SIGINT/SIGTERM to gracefully shutdown the server,
+// then executes the registered shutdown hooks within the shutdown deadline
+func StartServer(e *echo.Echo) {
+	go func() {
+		if err := e.StartServer(e.Server); err != nil {
+			if err == http.ErrServerClosed {
+				fmt.Println("shutting down the server")
+			} else {
+				e.Logger.Fatal(err)
+			}
+		}
+	}()
+
+	lifecycle.WaitForSignal()
+	ctx, cancel := context.WithTimeout(context.Background(), lifecycle.Timeout())
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		e.Logger.Error(err)
+	}
+	// the hooks have their own deadline, so a slow server shutdown does not skip them
+	if err := lifecycle.ShutdownWithTimeout(); err != nil {
+		e.Logger.Error(err)
+	}
+}
+
+// shutdownOnSignal executes the shutdown hooks when the Lambda runtime receives SIGTERM.
+// Note: Lambda only sends SIGTERM to functions having at least one registered extension.
+func shutdownOnSignal() {
+	lifecycle.WaitForSignal()
+	if err := lifecycle.ShutdownWithTimeout(); err != nil {
+		logger.LogError(context.Background(), err.Error())
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
 // Handler function to handle request, response through Lambda
 func Handler(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	// If no name is provided in the HTTP request body, throw an error
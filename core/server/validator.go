@@ -1,13 +1,20 @@
 package server
 
 import (
+	"fmt"
 	"io"
 	"mime/multipart"
 	"regexp"
+	"strconv"
 	"strings"
 
+	"github.com/namhoai1109/tabi/core/security/password"
+
 	"github.com/gabriel-vasile/mimetype"
+	ut "github.com/go-playground/universal-translator"
 	"github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+	vi_translations "github.com/go-playground/validator/v10/translations/vi"
 )
 
 // custom variable
@@ -16,9 +23,65 @@ var (
 	ImageExts    = []string{".jpg", ".jpeg", ".png"}
 )
 
+// validationTranslations holds messages of custom tags and overrides of built-in tags by language
+var validationTranslations = map[string]map[string]string{
+	LangEN: {
+		"required":    "{0} is required, but was not received",
+		"min":         "{0}'s value or length is less than allowed",
+		"max":         "{0}'s value or length is bigger than allowed",
+		"email":       "{0}'s value should be a valid email address",
+		"url":         "{0}'s value should be a valid URL",
+		"oneof":       "{0} should be one of {1}",
+		"ltfield":     "{0} should be less than {1}",
+		"gtfield":     "{0} should be greater than {1}",
+		"eqfield":     "{0} does not match {1}",
+		"date":        "{0}'s value should be in form of YYYY-MM-DD",
+		"mobile":      "{0}'s value should be a valid mobile number",
+		"document":    "{0} should be a PDF, JPG or PNG file",
+		"image":       "{0} should be a JPG or PNG image",
+		"fullname":    "{0}'s value should be a valid full name",
+		"description": "{0}'s value contains invalid characters",
+	},
+	LangVI: {
+		"oneof":       "{0} phải là một trong các giá trị {1}",
+		"date":        "{0} phải có định dạng YYYY-MM-DD",
+		"mobile":      "{0} phải là số điện thoại di động hợp lệ",
+		"document":    "{0} phải là tệp PDF, JPG hoặc PNG",
+		"image":       "{0} phải là ảnh JPG hoặc PNG",
+		"fullname":    "{0} phải là họ tên hợp lệ",
+		"description": "{0} chứa ký tự không hợp lệ",
+	},
+}
+
+// passwordTranslations holds messages of the password policy rules by language, see passwordRule
+var passwordTranslations = map[string]map[string]string{
+	LangEN: {
+		"password":          "{0} is too weak, please choose a stronger password",
+		"password_min":      "{0} must have at least {1} characters",
+		"password_max":      "{0} must not be longer than {1} characters",
+		"password_upper":    "{0} must contain an upper case letter",
+		"password_lower":    "{0} must contain a lower case letter",
+		"password_digit":    "{0} must contain a digit",
+		"password_symbol":   "{0} must contain a special character",
+		"password_breached": "{0} is commonly used or has been leaked, please choose another password",
+	},
+	LangVI: {
+		"password":          "{0} quá yếu, vui lòng chọn mật khẩu mạnh hơn",
+		"password_min":      "{0} phải có ít nhất {1} ký tự",
+		"password_max":      "{0} không được dài quá {1} ký tự",
+		"password_upper":    "{0} phải có ít nhất một chữ in hoa",
+		"password_lower":    "{0} phải có ít nhất một chữ thường",
+		"password_digit":    "{0} phải có ít nhất một chữ số",
+		"password_symbol":   "{0} phải có ít nhất một ký tự đặc biệt",
+		"password_breached": "{0} quá phổ biến hoặc đã bị lộ, vui lòng chọn mật khẩu khác",
+	},
+}
+
 // CustomValidator holds custom validator
 type CustomValidator struct {
 	V *validator.Validate
+	// Trans holds translators of validation messages
+	Trans *ut.UniversalTranslator
 }
 
 // NewValidator creates new custom validator
@@ -30,7 +93,28 @@ func NewValidator() *CustomValidator {
 	V.RegisterValidation("image", validateImage)
 	V.RegisterValidation("fullname", validateFullname)
 	V.RegisterValidation("description", validateDescription)
-	return &CustomValidator{V}
+	V.RegisterValidation("password", validatePassword)
+
+	trans := newUniversalTranslator()
+	if enTrans, ok := trans.GetTranslator(LangEN); ok {
+		en_translations.RegisterDefaultTranslations(V, enTrans)
+	}
+	if viTrans, ok := trans.GetTranslator(LangVI); ok {
+		vi_translations.RegisterDefaultTranslations(V, viTrans)
+	}
+	for lang, tags := range validationTranslations {
+		t, ok := trans.GetTranslator(lang)
+		if !ok {
+			continue
+		}
+		for tag, text := range tags {
+			registerTranslation(V, t, tag, text)
+		}
+		if msgs, ok := passwordTranslations[lang]; ok {
+			registerPasswordTranslation(V, t, msgs)
+		}
+	}
+	return &CustomValidator{V: V, Trans: trans}
 }
 
 // Validate validates the request
@@ -38,6 +122,76 @@ func (cv *CustomValidator) Validate(i interface{}) error {
 	return cv.V.Struct(i)
 }
 
+// TranslateError returns the message of the validation error in the given language
+func (cv *CustomValidator) TranslateError(fe validator.FieldError, lang string) string {
+	if cv.Trans == nil {
+		return getVldErrorMsg(fe)
+	}
+	trans, _ := cv.Trans.FindTranslator(lang)
+	if msg := fe.Translate(trans); msg != fe.Error() {
+		return msg
+	}
+	return getVldErrorMsg(fe)
+}
+
+func registerTranslation(v *validator.Validate, trans ut.Translator, tag, text string) error {
+	return v.RegisterTranslation(tag, trans, func(t ut.Translator) error {
+		return t.Add(tag, text, true)
+	}, func(t ut.Translator, fe validator.FieldError) string {
+		param := fe.Param()
+		if fe.Tag() == "oneof" {
+			param = strings.Replace(param, " ", ", ", -1)
+		}
+		msg, err := t.T(fe.Tag(), fe.Field(), param)
+		if err != nil {
+			return fe.Error()
+		}
+		return msg
+	})
+}
+
+// registerPasswordTranslation registers the messages of the password rules,
+// the message of the broken rule is picked by validating the value again
+func registerPasswordTranslation(v *validator.Validate, trans ut.Translator, msgs map[string]string) error {
+	return v.RegisterTranslation("password", trans, func(t ut.Translator) error {
+		for key, text := range msgs {
+			if err := t.Add(key, text, true); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func(t ut.Translator, fe validator.FieldError) string {
+		key, param := passwordRule(fe)
+		msg, err := t.T(key, fe.Field(), param)
+		if err != nil {
+			return fe.Error()
+		}
+		return msg
+	})
+}
+
+// passwordRule returns the message key of the password policy rule broken by the field and its param
+func passwordRule(fe validator.FieldError) (string, string) {
+	policy := password.GetPolicy()
+	switch policy.Validate(fmt.Sprint(fe.Value())) {
+	case password.ErrTooShort:
+		return "password_min", strconv.Itoa(policy.MinLength)
+	case password.ErrTooLong:
+		return "password_max", strconv.Itoa(policy.EffectiveMaxLength())
+	case password.ErrMissingUpper:
+		return "password_upper", ""
+	case password.ErrMissingLower:
+		return "password_lower", ""
+	case password.ErrMissingDigit:
+		return "password_digit", ""
+	case password.ErrMissingSymbol:
+		return "password_symbol", ""
+	case password.ErrBreached:
+		return "password_breached", ""
+	}
+	return "password", ""
+}
+
 func validateDate(fl validator.FieldLevel) bool {
 	val := fl.Field().String()
 	re := regexp.MustCompile(`^\d{4}-\d{1,2}-\d{1,2}(T00:00:00Z)?$`)
@@ -62,6 +216,11 @@ func validateDescription(fl validator.FieldLevel) bool {
 	return re.MatchString(strings.Replace(val, " ", "", -1))
 }
 
+// validatePassword validates the password with the policy set by password.SetPolicy
+func validatePassword(fl validator.FieldLevel) bool {
+	return password.GetPolicy().Validate(fl.Field().String()) == nil
+}
+
 func validateDocument(fl validator.FieldLevel) bool {
 	val := fl.Field().Interface().([]*multipart.FileHeader)
 	if len(val) == 0 {
@@ -1,30 +1,32 @@
 package sqs
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/namhoai1109/tabi/core/metrics"
+	"github.com/namhoai1109/tabi/core/middleware/logadapter"
+	"github.com/namhoai1109/tabi/core/tracing"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// MessagingSystem is the messaging system of the SQS spans
+const MessagingSystem = "aws_sqs"
+
 // SendMessage to send SQS message
 func (s *Service) SendMessage(queueURL string, message map[string]interface{}) (*sqs.SendMessageOutput, error) {
-	// ! double json encode
-	jsonMsg, err := json.Marshal(message)
-	if err != nil {
-		return nil, err
-	}
-
-	result, err := s.sqs.SendMessage(&sqs.SendMessageInput{
-		MessageBody: aws.String(string(jsonMsg)),
-		QueueUrl:    aws.String(queueURL),
-	})
-
-	if err != nil {
-		return nil, err
-	}
+	return s.SendMessageWithContext(context.Background(), queueURL, message)
+}
 
-	return result, nil
+// SendMessageWithContext to send SQS message with the request ID, correlation ID and trace context of the context as message attributes
+func (s *Service) SendMessageWithContext(ctx context.Context, queueURL string, message map[string]interface{}) (*sqs.SendMessageOutput, error) {
+	return s.sendMessage(ctx, queueURL, message, nil)
 }
 
 // GetQueueURL represents URL of the queue we want to send a message to
@@ -64,31 +66,114 @@ func (s *Service) DeleteMessageBatch(input *sqs.DeleteMessageBatchInput) (*sqs.D
 
 // SendMessageDelay to send message to SQS with delay seconds
 func (s *Service) SendMessageDelay(queueURL string, message map[string]interface{}, delaySeconds int64) (*sqs.SendMessageOutput, error) {
+	return s.SendMessageDelayWithContext(context.Background(), queueURL, message, delaySeconds)
+}
+
+// SendMessageDelayWithContext to send message to SQS with delay seconds and the request ID, correlation ID and trace context of the context
+func (s *Service) SendMessageDelayWithContext(ctx context.Context, queueURL string, message map[string]interface{}, delaySeconds int64) (*sqs.SendMessageOutput, error) {
+	return s.sendMessage(ctx, queueURL, message, &delaySeconds)
+}
+
+// SendMessageBatch to send batch of message to SQS
+func (s *Service) SendMessageBatch(input *sqs.SendMessageBatchInput) (*sqs.SendMessageBatchOutput, error) {
+	return s.SendMessageBatchWithContext(context.Background(), input)
+}
+
+// SendMessageBatchWithContext to send batch of message to SQS within a producer span,
+// with the request ID, correlation ID and trace context of the context as message attributes of every entry
+func (s *Service) SendMessageBatchWithContext(ctx context.Context, input *sqs.SendMessageBatchInput) (*sqs.SendMessageBatchOutput, error) {
+	queue := aws.StringValue(input.QueueUrl)
+	queue = queue[strings.LastIndex(queue, "/")+1:]
+	ctx, span := tracing.Start(ctx, queue+" send",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystem(MessagingSystem),
+			semconv.MessagingDestinationName(queue),
+			semconv.MessagingBatchMessageCount(len(input.Entries)),
+		),
+	)
+	defer span.End()
+
+	// the attributes set by the caller are kept
+	for key, value := range messageAttributes(ctx) {
+		for _, entry := range input.Entries {
+			if entry.MessageAttributes == nil {
+				entry.MessageAttributes = map[string]*sqs.MessageAttributeValue{}
+			}
+			if _, ok := entry.MessageAttributes[key]; !ok {
+				entry.MessageAttributes[key] = value
+			}
+		}
+	}
+
+	msgResult, err := s.sqs.SendMessageBatchWithContext(ctx, input)
+	if err != nil {
+		for range input.Entries {
+			metrics.IncSQSSent(queue, err)
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	for range msgResult.Successful {
+		metrics.IncSQSSent(queue, nil)
+	}
+	for _, failed := range msgResult.Failed {
+		metrics.IncSQSSent(queue, fmt.Errorf("%s", aws.StringValue(failed.Code)))
+	}
+	if len(msgResult.Failed) > 0 {
+		span.SetStatus(codes.Error, fmt.Sprintf("%d of %d messages failed", len(msgResult.Failed), len(input.Entries)))
+	}
+
+	return msgResult, nil
+}
+
+// sendMessage sends the message within a producer span and counts it
+func (s *Service) sendMessage(ctx context.Context, queueURL string, message map[string]interface{}, delaySeconds *int64) (*sqs.SendMessageOutput, error) {
 	// ! double json encode
 	jsonMsg, err := json.Marshal(message)
 	if err != nil {
 		return nil, err
 	}
 
-	result, err := s.sqs.SendMessage(&sqs.SendMessageInput{
-		MessageBody:  aws.String(string(jsonMsg)),
-		QueueUrl:     aws.String(queueURL),
-		DelaySeconds: &delaySeconds,
+	queue := queueURL[strings.LastIndex(queueURL, "/")+1:]
+	ctx, span := tracing.Start(ctx, queue+" send",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(semconv.MessagingSystem(MessagingSystem), semconv.MessagingDestinationName(queue)),
+	)
+	defer span.End()
+
+	result, err := s.sqs.SendMessageWithContext(ctx, &sqs.SendMessageInput{
+		MessageBody:       aws.String(string(jsonMsg)),
+		QueueUrl:          aws.String(queueURL),
+		DelaySeconds:      delaySeconds,
+		MessageAttributes: messageAttributes(ctx),
 	})
+	metrics.IncSQSSent(queue, err)
 
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return nil, err
 	}
+	span.SetAttributes(semconv.MessagingMessageID(aws.StringValue(result.MessageId)))
 
 	return result, nil
 }
 
-// SendMessageBatch to send batch of message to SQS
-func (s *Service) SendMessageBatch(input *sqs.SendMessageBatchInput) (*sqs.SendMessageBatchOutput, error) {
-	msgResult, err := s.sqs.SendMessageBatch(input)
-	if err != nil {
-		return nil, err
+// messageAttributes returns the request ID, correlation ID and trace context of the context as message attributes
+func messageAttributes(ctx context.Context) map[string]*sqs.MessageAttributeValue {
+	headers := logadapter.PropagationHeaders(ctx)
+	tracing.Inject(ctx, headers)
+	if len(headers) == 0 {
+		return nil
 	}
-
-	return msgResult, nil
+	attrs := make(map[string]*sqs.MessageAttributeValue, len(headers))
+	for key, value := range headers {
+		attrs[key] = &sqs.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(value),
+		}
+	}
+	return attrs
 }
@@ -0,0 +1,46 @@
+package tracing
+
+import (
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/semconv/v1.17.0/httpconv"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware returns a middleware which creates a server span for each request,
+// continuing the trace of the traceparent header if any.
+// Note: it must be registered before the middleware rendering the errors, so the response status is final.
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+
+			route := c.Path()
+			if route == "" {
+				route = req.URL.Path
+			}
+			ctx, span := Start(ctx, req.Method+" "+route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(httpconv.ServerRequest("", req)...),
+				trace.WithAttributes(semconv.HTTPRoute(route)),
+			)
+			defer span.End()
+			c.SetRequest(req.WithContext(ctx))
+
+			err := next(c)
+			if err != nil {
+				span.RecordError(err)
+			}
+			status := c.Response().Status
+			span.SetAttributes(semconv.HTTPStatusCode(status))
+			if code, msg := httpconv.ServerStatus(status); code != codes.Unset {
+				span.SetStatus(code, msg)
+			}
+			return err
+		}
+	}
+}
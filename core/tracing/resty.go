@@ -0,0 +1,60 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/go-resty/resty/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/semconv/v1.17.0/httpconv"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type spanKey struct{}
+
+// requestSpan holds the span of the request attempt and the context of the caller,
+// so retried attempts are siblings instead of children of the previous attempt
+type requestSpan struct {
+	parent context.Context
+	span   trace.Span
+}
+
+// InstrumentClient creates a client span for each request of the resty client
+// and injects the trace context into the request headers
+func InstrumentClient(client *resty.Client) *resty.Client {
+	client.OnBeforeRequest(func(c *resty.Client, req *resty.Request) error {
+		parent := req.Context()
+		if rs, ok := parent.Value(spanKey{}).(*requestSpan); ok {
+			parent = rs.parent
+		}
+		ctx, span := Start(parent, "HTTP "+req.Method,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(semconv.HTTPMethod(req.Method), semconv.HTTPURL(c.BaseURL+req.URL)),
+		)
+		otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+		req.SetContext(context.WithValue(ctx, spanKey{}, &requestSpan{parent: parent, span: span}))
+		return nil
+	})
+	client.OnAfterResponse(func(c *resty.Client, resp *resty.Response) error {
+		if rs, ok := resp.Request.Context().Value(spanKey{}).(*requestSpan); ok {
+			span := rs.span
+			span.SetAttributes(semconv.HTTPStatusCode(resp.StatusCode()))
+			if code, msg := httpconv.ClientStatus(resp.StatusCode()); code != codes.Unset {
+				span.SetStatus(code, msg)
+			}
+			span.End()
+		}
+		return nil
+	})
+	client.OnError(func(req *resty.Request, err error) {
+		if rs, ok := req.Context().Value(spanKey{}).(*requestSpan); ok {
+			span := rs.span
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			span.End()
+		}
+	})
+	return client
+}
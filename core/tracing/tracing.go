@@ -0,0 +1,117 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName is the name of the tracer used by the core packages
+const InstrumentationName = "github.com/namhoai1109/tabi"
+
+// Config represents tracing specific config
+type Config struct {
+	ServiceName string
+	Stage       string
+	// SampleRatio is the ratio of sampled root spans, from 0 to 1 (default)
+	SampleRatio float64
+	// Exporter exports the finished spans, e.g. an OTLP exporter. If nil, spans are dropped
+	Exporter sdktrace.SpanExporter
+	// Sync exports the spans as soon as they end instead of in batches, the in-memory exporter is always synchronous
+	Sync bool
+}
+
+// DefaultConfig for tracing
+var DefaultConfig = Config{
+	ServiceName: "tabi",
+	Stage:       "development",
+	SampleRatio: 1,
+}
+
+func (c *Config) fillDefaults() {
+	if c.ServiceName == "" {
+		c.ServiceName = DefaultConfig.ServiceName
+	}
+	if c.Stage == "" {
+		c.Stage = DefaultConfig.Stage
+	}
+	if c.SampleRatio <= 0 {
+		c.SampleRatio = DefaultConfig.SampleRatio
+	}
+	if c.Exporter == nil {
+		c.Exporter = noopExporter{}
+	}
+}
+
+// Init sets the global tracer provider and the W3C trace context propagator.
+// Until Init is called, all spans of the core packages are no-op.
+// The provider should be shut down to flush the remaining spans, e.g:
+// server.OnShutdown("tracing", tp.Shutdown)
+func Init(cfg *Config) (*sdktrace.TracerProvider, error) {
+	cfg.fillDefaults()
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(cfg.ServiceName),
+		semconv.DeploymentEnvironment(cfg.Stage),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	}
+	// in-memory exporter is used by tests, so the spans are exported as soon as they end
+	if _, ok := cfg.Exporter.(*tracetest.InMemoryExporter); ok || cfg.Sync {
+		opts = append(opts, sdktrace.WithSyncer(cfg.Exporter))
+	} else {
+		opts = append(opts, sdktrace.WithBatcher(cfg.Exporter))
+	}
+
+	tp := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return tp, nil
+}
+
+// NewInMemoryExporter creates new exporter which keeps the finished spans in memory, e.g. for tests:
+// exporter := tracing.NewInMemoryExporter()
+// tracing.Init(&tracing.Config{Exporter: exporter})
+// spans := exporter.GetSpans()
+func NewInMemoryExporter() *tracetest.InMemoryExporter {
+	return tracetest.NewInMemoryExporter()
+}
+
+// Tracer returns the tracer of the core packages
+func Tracer() trace.Tracer {
+	return otel.Tracer(InstrumentationName)
+}
+
+// Start creates new span and a copy of the context holding it
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, opts...)
+}
+
+// Inject writes the trace context of the context into the carrier, e.g. message attributes
+func Inject(ctx context.Context, carrier map[string]string) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(carrier))
+}
+
+// Extract returns a copy of the context holding the trace context of the carrier
+func Extract(ctx context.Context, carrier map[string]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(carrier))
+}
+
+// noopExporter drops the finished spans
+type noopExporter struct{}
+
+func (noopExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error { return nil }
+
+func (noopExporter) Shutdown(ctx context.Context) error { return nil }
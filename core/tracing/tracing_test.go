@@ -0,0 +1,80 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	remoteTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	remoteSpanID  = "00f067aa0ba902b7"
+)
+
+func attr(span tracetest.SpanStub, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestMiddleware(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	tp, err := Init(&Config{Exporter: exporter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tp.Shutdown(context.Background())
+
+	e := echo.New()
+	e.Use(Middleware())
+	e.GET("/v1/hotels/:id", func(c echo.Context) error {
+		_, span := Start(c.Request().Context(), "load hotel", trace.WithAttributes(attribute.String("hotel.id", c.Param("id"))))
+		span.End()
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/hotels/42", nil)
+	req.Header.Set("traceparent", "00-"+remoteTraceID+"-"+remoteSpanID+"-01")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	child, server := spans[0], spans[1]
+
+	if server.Name != "GET /v1/hotels/:id" || server.SpanKind != trace.SpanKindServer {
+		t.Errorf("server span = %q of kind %v", server.Name, server.SpanKind)
+	}
+	if got := server.SpanContext.TraceID().String(); got != remoteTraceID {
+		t.Errorf("server trace ID = %s, want %s", got, remoteTraceID)
+	}
+	if got := server.Parent.SpanID().String(); got != remoteSpanID || !server.Parent.IsRemote() {
+		t.Errorf("server parent = %s, want remote %s", got, remoteSpanID)
+	}
+	if got := attr(server, "http.route").AsString(); got != "/v1/hotels/:id" {
+		t.Errorf("http.route = %q", got)
+	}
+	if got := attr(server, "http.status_code").AsInt64(); got != http.StatusNoContent {
+		t.Errorf("http.status_code = %d", got)
+	}
+
+	if child.Name != "load hotel" {
+		t.Errorf("child span = %q", child.Name)
+	}
+	if child.Parent.SpanID() != server.SpanContext.SpanID() || child.SpanContext.TraceID() != server.SpanContext.TraceID() {
+		t.Errorf("child parent = %s, want %s", child.Parent.SpanID(), server.SpanContext.SpanID())
+	}
+	if got := attr(child, "hotel.id").AsString(); got != "42" {
+		t.Errorf("hotel.id = %q", got)
+	}
+}